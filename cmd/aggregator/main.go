@@ -1,14 +1,17 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 
 	"github.com/caarlos0/env"
 	"github.com/chackett/zignews/pkg/aggregator"
-	"github.com/chackett/zignews/pkg/storage/mongodb"
-	"github.com/nats-io/nats.go"
+	"github.com/chackett/zignews/pkg/archive"
+	"github.com/chackett/zignews/pkg/events"
+	_ "github.com/chackett/zignews/pkg/rssprovider" // Register supported provider types
 	"github.com/pkg/errors"
 )
 
@@ -24,30 +27,61 @@ func main() {
 		log.Fatal(errors.Wrap(err, "parse config"))
 	}
 
-	artRepo, err := mongodb.NewArticleRepository(config.MongoAddress, config.MongoUser, config.MongoPass, config.MongoDatabase)
+	repos, err := newRepositories(config)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "create article repository"))
+		log.Fatal(errors.Wrap(err, "create repositories"))
 	}
+	artRepo, provRepo := repos.articles, repos.providers
 
-	provRepo, err := mongodb.NewProviderRepository(config.MongoAddress, config.MongoUser, config.MongoPass, config.MongoDatabase)
+	// When leases are used, jobs are built for this instance's share of the providers once it's running
+	var jobs []*aggregator.Job
+	if !config.UseLeases {
+		jobs, err = aggregator.BuildJobs(provRepo, artRepo)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "aggregator BuildJobs()"))
+		}
+		log.Printf("Found %d jobs.", len(jobs))
+	}
+
+	msgBus, err := events.NewNats(config.MsgQueueConn)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "create article repository"))
+		log.Fatalf("ERROR: Connect to message queue - %s", errors.Wrap(err, "aggregator BuildJobs()").Error())
 	}
 
-	jobs, err := aggregator.BuildJobs(provRepo, artRepo)
+	agg, err := aggregator.NewAggregator(jobs, config.DelayJobStart, msgBus, provRepo, artRepo)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "aggregator BuildJobs()"))
+		log.Fatal(errors.Wrap(err, "create aggregator"))
 	}
-	log.Printf("Found %d jobs.", len(jobs))
 
-	msgBus, err := nats.Connect(config.MsgQueueConn)
+	scheduler, err := aggregator.NewScheduler(config.FetchWorkers, config.HostInterval, config.HostBurst, config.RespectRobotsTxt)
 	if err != nil {
-		log.Fatalf("ERROR: Connect to message queue - %s", errors.Wrap(err, "aggregator BuildJobs()").Error())
+		log.Fatal(errors.Wrap(err, "create fetch scheduler"))
 	}
+	agg.UseScheduler(scheduler)
 
-	agg, err := aggregator.NewAggregator(jobs, config.DelayJobStart, msgBus, provRepo, artRepo)
+	// Expired articles are deleted without being archived if there's no archive directory
+	var arch *archive.Archive
+	if config.ArchiveDir != "" {
+		arch, err = archive.New(config.ArchiveDir)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "open archive"))
+		}
+	}
+	err = agg.UseRetention(config.RetentionDays, config.RetentionInterval, arch)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "create aggregator"))
+		log.Fatal(errors.Wrap(err, "use retention"))
+	}
+
+	if config.UseLeases {
+		instanceID := config.InstanceID
+		if instanceID == "" {
+			hostname, _ := os.Hostname()
+			instanceID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+		err = agg.UseLeases(repos.leases, instanceID, config.LeaseTTL)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "use leases"))
+		}
 	}
 
 	// A hack so I can handle start error. Should use channel to get result from goroutine.
@@ -58,6 +92,17 @@ func main() {
 		}
 	}()
 
+	adminAPI, err := aggregator.NewAdminHandler(agg, config.AdminAddress)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "create aggregator admin http handler"))
+	}
+	go func() {
+		err := adminAPI.Start()
+		if err != nil {
+			log.Fatalf("ERROR: Start admin api - %s", err.Error())
+		}
+	}()
+
 	/*
 		The application should stay open until it is commanded to quit. Even if there are no jobs / providers found to process.
 		The reason is that this application will listen out for "new provider" events and then start jobs based on those providers.
@@ -69,7 +114,16 @@ func main() {
 	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
 	signal.Notify(c, os.Interrupt)
 	<-c
+	err = adminAPI.Stop()
+	if err != nil {
+		log.Printf("ERROR: Stop admin api - %s", err.Error())
+	}
 	agg.Stop()
+	msgBus.Close()
+	err = repos.close(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Close storage - %s", err.Error())
+	}
 	log.Println("shutting down")
 	os.Exit(0)
 }
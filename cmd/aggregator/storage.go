@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/chackett/zignews/pkg/storage/memory"
+	"github.com/chackett/zignews/pkg/storage/mongodb"
+	"github.com/chackett/zignews/pkg/storage/postgres"
+	"github.com/chackett/zignews/pkg/storage/sqlite"
+	"github.com/pkg/errors"
+)
+
+// Storage backends
+const (
+	backendMongoDB  = "mongodb"
+	backendPostgres = "postgres"
+	backendSQLite   = "sqlite"
+	backendMemory   = "memory"
+)
+
+// repositories are the storage the aggregator uses
+type repositories struct {
+	articles  storage.ArticleRepository
+	providers storage.ProviderRepository
+	leases    storage.LeaseRepository
+	// close releases the connection to the storage backend on shutdown
+	close func(ctx context.Context) error
+}
+
+// newRepositories returns the repositories for the storage backend selected by `config`. The lease repository is only
+// created if leases are used.
+func newRepositories(config Config) (repositories, error) {
+	switch config.StorageBackend {
+	case backendMongoDB:
+		return newMongoRepositories(config)
+	case backendPostgres:
+		db, err := postgres.Open(config.PostgresDSN)
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "open postgres")
+		}
+		return repositories{
+			articles:  postgres.NewArticleRepository(db),
+			providers: postgres.NewProviderRepository(db),
+			leases:    postgres.NewLeaseRepository(db),
+			close:     func(context.Context) error { return db.Close() },
+		}, nil
+	case backendSQLite:
+		db, err := sqlite.Open(config.SQLitePath)
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "open sqlite")
+		}
+		return repositories{
+			articles:  sqlite.NewArticleRepository(db),
+			providers: sqlite.NewProviderRepository(db),
+			leases:    sqlite.NewLeaseRepository(db),
+			close:     func(context.Context) error { return db.Close() },
+		}, nil
+	case backendMemory:
+		// Nothing is shared with other processes, so the providers are bootstrapped each time
+		providers := memory.NewProviderRepository()
+		_, err := providers.InsertProviders(context.Background(), storage.DefaultProviders())
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "bootstrap providers")
+		}
+		return repositories{
+			articles:  memory.NewArticleRepository(),
+			providers: providers,
+			leases:    memory.NewLeaseRepository(),
+			close:     func(context.Context) error { return nil },
+		}, nil
+	default:
+		return repositories{}, fmt.Errorf("`%s` is an unsupported storage backend", config.StorageBackend)
+	}
+}
+
+// newMongoRepositories returns repositories sharing one client
+func newMongoRepositories(config Config) (repositories, error) {
+	var result repositories
+	client, err := mongodb.Connect(mongoConfig(config))
+	if err != nil {
+		return result, errors.Wrap(err, "connect to mongo")
+	}
+	result.close = client.Disconnect
+
+	warnPendingMigrations(client)
+	result.articles = mongodb.NewArticleRepository(client)
+	result.providers = mongodb.NewProviderRepository(client)
+
+	if config.UseLeases {
+		result.leases = mongodb.NewLeaseRepository(client)
+	}
+	return result, nil
+}
+
+// warnPendingMigrations logs if the database hasn't been migrated, which is done by `cmd/migrate` rather than on start
+func warnPendingMigrations(client *mongodb.Client) {
+	pending, err := mongodb.PendingMigrations(context.Background(), client)
+	if err != nil {
+		log.Printf("ERROR: check migrations - %s", err.Error())
+		return
+	}
+	if pending > 0 {
+		log.Printf("WARNING: %d database migrations are pending, apply them with cmd/migrate", pending)
+	}
+}
+
+func mongoConfig(config Config) mongodb.Config {
+	return mongodb.Config{
+		URI:                    config.MongoURI,
+		Hosts:                  strings.Split(config.MongoAddress, ","),
+		User:                   config.MongoUser,
+		Password:               config.MongoPass,
+		Database:               config.MongoDatabase,
+		AuthSource:             config.MongoAuthSource,
+		ReplicaSet:             config.MongoReplicaSet,
+		TLS:                    config.MongoTLS,
+		TLSCAFile:              config.MongoTLSCAFile,
+		ConnectTimeout:         config.MongoConnectTimeout,
+		ServerSelectionTimeout: config.MongoServerSelectionTimeout,
+		PingTimeout:            config.MongoConnectTimeout,
+	}
+}
@@ -0,0 +1,110 @@
+// Command migrate applies the database migrations the services need. Run `migrate status` to list the migrations
+// without applying them.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/caarlos0/env"
+	"github.com/chackett/zignews/pkg/storage/mongodb"
+	"github.com/chackett/zignews/pkg/storage/postgres"
+	"github.com/chackett/zignews/pkg/storage/sqlite"
+	"github.com/pkg/errors"
+)
+
+func main() {
+
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	var config Config
+	err := env.Parse(&config)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "parse config"))
+	}
+
+	statusOnly := len(os.Args) > 1 && os.Args[1] == "status"
+
+	switch config.StorageBackend {
+	case "mongodb":
+		err = migrateMongo(config, statusOnly)
+	case "postgres", "sqlite":
+		if statusOnly {
+			log.Fatalf("Status isn't available for `%s`, which is migrated when opened", config.StorageBackend)
+		}
+		err = migrateSQL(config)
+	default:
+		err = fmt.Errorf("`%s` is an unsupported storage backend", config.StorageBackend)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func migrateMongo(config Config, statusOnly bool) error {
+	client, err := mongodb.Connect(mongoConfig(config))
+	if err != nil {
+		return errors.Wrap(err, "connect to mongo")
+	}
+	ctx := context.Background()
+	defer client.Disconnect(ctx)
+
+	if statusOnly {
+		migrations, err := mongodb.Migrations(ctx, client)
+		if err != nil {
+			return errors.Wrap(err, "get migrations")
+		}
+		for _, m := range migrations {
+			applied := "pending"
+			if !m.Applied.IsZero() {
+				applied = "applied " + m.Applied.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%3d  %-50s  %s\n", m.Version, m.Description, applied)
+		}
+		return nil
+	}
+
+	applied, err := mongodb.Migrate(ctx, client)
+	log.Printf("Applied %d migrations", len(applied))
+	if err != nil {
+		return errors.Wrap(err, "migrate")
+	}
+	return nil
+}
+
+// migrateSQL opens the database, which applies its migrations
+func migrateSQL(config Config) error {
+	var db *sql.DB
+	var err error
+	if config.StorageBackend == "postgres" {
+		db, err = postgres.Open(config.PostgresDSN)
+	} else {
+		db, err = sqlite.Open(config.SQLitePath)
+	}
+	if err != nil {
+		return errors.Wrap(err, "migrate")
+	}
+	log.Printf("Migrated %s", config.StorageBackend)
+	return db.Close()
+}
+
+func mongoConfig(config Config) mongodb.Config {
+	return mongodb.Config{
+		URI:                    config.MongoURI,
+		Hosts:                  strings.Split(config.MongoAddress, ","),
+		User:                   config.MongoUser,
+		Password:               config.MongoPass,
+		Database:               config.MongoDatabase,
+		AuthSource:             config.MongoAuthSource,
+		ReplicaSet:             config.MongoReplicaSet,
+		TLS:                    config.MongoTLS,
+		TLSCAFile:              config.MongoTLSCAFile,
+		ConnectTimeout:         config.MongoConnectTimeout,
+		ServerSelectionTimeout: config.MongoServerSelectionTimeout,
+		PingTimeout:            config.MongoConnectTimeout,
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
 
 	"github.com/caarlos0/env"
+	"github.com/chackett/zignews/pkg/archive"
+	"github.com/chackett/zignews/pkg/events"
 	mobileapi "github.com/chackett/zignews/pkg/mobile-api"
-	"github.com/chackett/zignews/pkg/storage/mongodb"
-	"github.com/nats-io/nats.go"
+	_ "github.com/chackett/zignews/pkg/rssprovider" // Register supported provider types
 	"github.com/pkg/errors"
 )
 
@@ -21,25 +25,27 @@ func main() {
 		log.Fatal(errors.Wrap(err, "parse config"))
 	}
 
-	artRepo, err := mongodb.NewArticleRepository(config.MongoAddress, config.MongoUser, config.MongoPass, config.MongoDatabase)
+	repos, err := newRepositories(config)
 	if err != nil {
-		log.Fatal(errors.Wrap(err, "create article repository"))
+		log.Fatal(errors.Wrap(err, "create repositories"))
 	}
 
-	provRepo, err := mongodb.NewProviderRepository(config.MongoAddress, config.MongoUser, config.MongoPass, config.MongoDatabase)
-	if err != nil {
-		log.Fatal(errors.Wrap(err, "create article repository"))
-	}
-
-	msgBus, err := nats.Connect(config.MsgQueueConn)
+	msgBus, err := events.NewNats(config.MsgQueueConn)
 	if err != nil {
 		log.Fatalf("ERROR: Connect to message queue - %s", errors.Wrap(err, "aggregator BuildJobs()").Error())
 	}
 
-	svc, err := mobileapi.NewService(artRepo, provRepo, msgBus)
+	svc, err := mobileapi.NewService(repos.articles, repos.providers, msgBus)
 	if err != nil {
 		log.Fatal(errors.Wrap(err, "create new mobileapi service"))
 	}
+	if config.ArchiveDir != "" {
+		arch, err := archive.New(config.ArchiveDir)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "open archive"))
+		}
+		svc.UseArchive(arch)
+	}
 
 	httpAPI, err := mobileapi.NewHandler(svc, config.APIAddress)
 	if err != nil {
@@ -48,6 +54,25 @@ func main() {
 
 	fmt.Println("mobile api running..")
 
-	log.Fatal(httpAPI.Start())
+	go func() {
+		err := httpAPI.Start()
+		if err != nil {
+			log.Fatalf("ERROR: Start mobile api - %s", err.Error())
+		}
+	}()
 
+	// Hold application until instructed to quit via SIGINT (Ctrl+C)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	<-c
+	err = httpAPI.Stop()
+	if err != nil {
+		log.Printf("ERROR: Stop mobile api - %s", err.Error())
+	}
+	msgBus.Close()
+	err = repos.close(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Close storage - %s", err.Error())
+	}
+	log.Println("shutting down")
 }
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/chackett/zignews/pkg/storage/memory"
+	"github.com/chackett/zignews/pkg/storage/mongodb"
+	"github.com/chackett/zignews/pkg/storage/postgres"
+	"github.com/chackett/zignews/pkg/storage/sqlite"
+	"github.com/pkg/errors"
+)
+
+// Storage backends
+const (
+	backendMongoDB  = "mongodb"
+	backendPostgres = "postgres"
+	backendSQLite   = "sqlite"
+	backendMemory   = "memory"
+)
+
+// repositories are the storage the mobile api uses
+type repositories struct {
+	articles  storage.ArticleRepository
+	providers storage.ProviderRepository
+	// close releases the connection to the storage backend on shutdown
+	close func(ctx context.Context) error
+}
+
+// newRepositories returns the repositories for the storage backend selected by `config`
+func newRepositories(config Config) (repositories, error) {
+	switch config.StorageBackend {
+	case backendMongoDB:
+		client, err := mongodb.Connect(mongoConfig(config))
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "connect to mongo")
+		}
+		warnPendingMigrations(client)
+		return repositories{
+			articles:  mongodb.NewArticleRepository(client),
+			providers: mongodb.NewProviderRepository(client),
+			close:     client.Disconnect,
+		}, nil
+	case backendPostgres:
+		db, err := postgres.Open(config.PostgresDSN)
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "open postgres")
+		}
+		return repositories{
+			articles:  postgres.NewArticleRepository(db),
+			providers: postgres.NewProviderRepository(db),
+			close:     func(context.Context) error { return db.Close() },
+		}, nil
+	case backendSQLite:
+		db, err := sqlite.Open(config.SQLitePath)
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "open sqlite")
+		}
+		return repositories{
+			articles:  sqlite.NewArticleRepository(db),
+			providers: sqlite.NewProviderRepository(db),
+			close:     func(context.Context) error { return db.Close() },
+		}, nil
+	case backendMemory:
+		// Nothing is shared with other processes, so the providers are bootstrapped each time
+		provRepo := memory.NewProviderRepository()
+		_, err := provRepo.InsertProviders(context.Background(), storage.DefaultProviders())
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "bootstrap providers")
+		}
+		return repositories{
+			articles:  memory.NewArticleRepository(),
+			providers: provRepo,
+			close:     func(context.Context) error { return nil },
+		}, nil
+	default:
+		return repositories{}, fmt.Errorf("`%s` is an unsupported storage backend", config.StorageBackend)
+	}
+}
+
+// warnPendingMigrations logs if the database hasn't been migrated, which is done by `cmd/migrate` rather than on start
+func warnPendingMigrations(client *mongodb.Client) {
+	pending, err := mongodb.PendingMigrations(context.Background(), client)
+	if err != nil {
+		log.Printf("ERROR: check migrations - %s", err.Error())
+		return
+	}
+	if pending > 0 {
+		log.Printf("WARNING: %d database migrations are pending, apply them with cmd/migrate", pending)
+	}
+}
+
+func mongoConfig(config Config) mongodb.Config {
+	return mongodb.Config{
+		URI:                    config.MongoURI,
+		Hosts:                  strings.Split(config.MongoAddress, ","),
+		User:                   config.MongoUser,
+		Password:               config.MongoPass,
+		Database:               config.MongoDatabase,
+		AuthSource:             config.MongoAuthSource,
+		ReplicaSet:             config.MongoReplicaSet,
+		TLS:                    config.MongoTLS,
+		TLSCAFile:              config.MongoTLSCAFile,
+		ConnectTimeout:         config.MongoConnectTimeout,
+		ServerSelectionTimeout: config.MongoServerSelectionTimeout,
+		PingTimeout:            config.MongoConnectTimeout,
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// Config defines configuration that comes from envars
+type Config struct {
+	APIAddress    string `env:"API_ADDR" envDefault:":8080"`
+	AdminAddress  string `env:"ADMIN_ADDR" envDefault:":8081"` // Admin API for job status and triggering polls.
+	DelayJobStart bool   `env:"DELAY_START" envDefault:"false"`
+	// All jobs fetch through a shared scheduler, which bounds concurrency and rate limits each host.
+	FetchWorkers     int           `env:"FETCH_WORKERS" envDefault:"8"`
+	HostInterval     time.Duration `env:"HOST_INTERVAL" envDefault:"2s"` // Minimum time between fetches from a host, after bursts.
+	HostBurst        int           `env:"HOST_BURST" envDefault:"1"`
+	RespectRobotsTxt bool          `env:"RESPECT_ROBOTS_TXT" envDefault:"true"` // Slow down for a host's robots.txt Crawl-delay.
+	// Articles older than RETENTION_DAYS are removed, unless their provider has its own retention policy. Zero keeps
+	// them forever. Removed articles are archived to ARCHIVE_DIR first, if it's set.
+	RetentionDays     int           `env:"RETENTION_DAYS" envDefault:"0"`
+	RetentionInterval time.Duration `env:"RETENTION_INTERVAL" envDefault:"1h"` // Time between sweeps for expired articles.
+	ArchiveDir        string        `env:"ARCHIVE_DIR"`
+	// Storage is `sqlite`, or `memory` for development.
+	StorageBackend string `env:"STORAGE_BACKEND" envDefault:"sqlite"`
+	SQLitePath     string `env:"SQLITE_PATH" envDefault:"zignews.db"`
+}
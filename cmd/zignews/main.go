@@ -0,0 +1,124 @@
+// Command zignews runs the aggregator and mobile API in one process, for single node installs with no external
+// services. Storage is a local SQLite file and events are passed in process.
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/caarlos0/env"
+	"github.com/chackett/zignews/pkg/aggregator"
+	"github.com/chackett/zignews/pkg/archive"
+	"github.com/chackett/zignews/pkg/events"
+	mobileapi "github.com/chackett/zignews/pkg/mobile-api"
+	_ "github.com/chackett/zignews/pkg/rssprovider" // Register supported provider types
+	"github.com/pkg/errors"
+)
+
+func main() {
+
+	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
+
+	log.Print("Zignews")
+
+	var config Config
+	err := env.Parse(&config)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "parse config"))
+	}
+
+	repos, err := newRepositories(config)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "create repositories"))
+	}
+	artRepo, provRepo := repos.articles, repos.providers
+
+	// The services share the bus, so providers saved through the API are picked up by the aggregator
+	msgBus := events.NewLocal()
+
+	jobs, err := aggregator.BuildJobs(provRepo, artRepo)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "aggregator BuildJobs()"))
+	}
+	log.Printf("Found %d jobs.", len(jobs))
+
+	agg, err := aggregator.NewAggregator(jobs, config.DelayJobStart, msgBus, provRepo, artRepo)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "create aggregator"))
+	}
+
+	scheduler, err := aggregator.NewScheduler(config.FetchWorkers, config.HostInterval, config.HostBurst, config.RespectRobotsTxt)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "create fetch scheduler"))
+	}
+	agg.UseScheduler(scheduler)
+
+	// Expired articles are deleted without being archived if there's no archive directory
+	var arch *archive.Archive
+	if config.ArchiveDir != "" {
+		arch, err = archive.New(config.ArchiveDir)
+		if err != nil {
+			log.Fatal(errors.Wrap(err, "open archive"))
+		}
+	}
+	err = agg.UseRetention(config.RetentionDays, config.RetentionInterval, arch)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "use retention"))
+	}
+
+	err = agg.Start()
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "start aggregator"))
+	}
+
+	adminAPI, err := aggregator.NewAdminHandler(agg, config.AdminAddress)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "create aggregator admin http handler"))
+	}
+	go func() {
+		err := adminAPI.Start()
+		if err != nil {
+			log.Fatalf("ERROR: Start admin api - %s", err.Error())
+		}
+	}()
+
+	svc, err := mobileapi.NewService(artRepo, provRepo, msgBus)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "create new mobileapi service"))
+	}
+	if arch != nil {
+		svc.UseArchive(arch)
+	}
+	httpAPI, err := mobileapi.NewHandler(svc, config.APIAddress)
+	if err != nil {
+		log.Fatal(errors.Wrap(err, "create new mobileapi http handler"))
+	}
+	go func() {
+		err := httpAPI.Start()
+		if err != nil {
+			log.Fatalf("ERROR: Start mobile api - %s", err.Error())
+		}
+	}()
+
+	// Hold application until instructed to quit via SIGINT (Ctrl+C)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	<-c
+	err = httpAPI.Stop()
+	if err != nil {
+		log.Printf("ERROR: Stop mobile api - %s", err.Error())
+	}
+	err = adminAPI.Stop()
+	if err != nil {
+		log.Printf("ERROR: Stop admin api - %s", err.Error())
+	}
+	agg.Stop()
+	err = repos.close(context.Background())
+	if err != nil {
+		log.Printf("ERROR: Close storage - %s", err.Error())
+	}
+	log.Println("shutting down")
+	os.Exit(0)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/chackett/zignews/pkg/storage/memory"
+	"github.com/chackett/zignews/pkg/storage/sqlite"
+	"github.com/pkg/errors"
+)
+
+// Storage backends
+const (
+	backendSQLite = "sqlite"
+	backendMemory = "memory"
+)
+
+// repositories are the storage shared by the services
+type repositories struct {
+	articles  storage.ArticleRepository
+	providers storage.ProviderRepository
+	// close releases the storage backend on shutdown
+	close func(ctx context.Context) error
+}
+
+// newRepositories returns the repositories for the storage backend selected by `config`. Both are local to the node.
+func newRepositories(config Config) (repositories, error) {
+	switch config.StorageBackend {
+	case backendSQLite:
+		db, err := sqlite.Open(config.SQLitePath)
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "open sqlite")
+		}
+		return repositories{
+			articles:  sqlite.NewArticleRepository(db),
+			providers: sqlite.NewProviderRepository(db),
+			close:     func(context.Context) error { return db.Close() },
+		}, nil
+	case backendMemory:
+		provRepo := memory.NewProviderRepository()
+		_, err := provRepo.InsertProviders(context.Background(), storage.DefaultProviders())
+		if err != nil {
+			return repositories{}, errors.Wrap(err, "bootstrap providers")
+		}
+		return repositories{
+			articles:  memory.NewArticleRepository(),
+			providers: provRepo,
+			close:     func(context.Context) error { return nil },
+		}, nil
+	default:
+		return repositories{}, fmt.Errorf("`%s` is an unsupported storage backend", config.StorageBackend)
+	}
+}
@@ -0,0 +1,74 @@
+package aggregator
+
+import (
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+const (
+	// adaptiveSpeedUp divides the poll frequency when a poll finds new articles
+	adaptiveSpeedUp = 2
+	// adaptiveSlowDown multiplies the poll frequency when a poll finds nothing new. It's gentler than speeding up, so a
+	// feed that publishes in bursts is caught quickly once it gets busy again.
+	adaptiveSlowDown = 1.5
+)
+
+// adaptive learns how often to poll a feed from how often new articles appear in it
+type adaptive struct {
+	min, max time.Duration
+	// seen holds the GUIDs in the feed at the last poll. It's nil until the first poll, which can't tell what's new.
+	seen map[string]struct{}
+}
+
+func newAdaptive(min, max time.Duration) *adaptive {
+	return &adaptive{
+		min: min,
+		max: max,
+	}
+}
+
+// next returns the poll frequency following a poll that returned `articles`, given the current `frequency`. Articles
+// are nil if the feed was not modified.
+func (a *adaptive) next(frequency time.Duration, articles []storage.Article) time.Duration {
+	if articles == nil && a.seen != nil {
+		return a.bound(time.Duration(float64(frequency) * adaptiveSlowDown))
+	}
+	if articles == nil {
+		return frequency
+	}
+
+	first := a.seen == nil
+	fresh := 0
+	seen := make(map[string]struct{}, len(articles))
+	for _, article := range articles {
+		key := article.GUID
+		if key == "" {
+			key = article.Link
+		}
+		seen[key] = struct{}{}
+		if _, ok := a.seen[key]; !ok {
+			fresh++
+		}
+	}
+	a.seen = seen
+
+	switch {
+	case first:
+		return frequency
+	case fresh > 0:
+		return a.bound(frequency / adaptiveSpeedUp)
+	default:
+		return a.bound(time.Duration(float64(frequency) * adaptiveSlowDown))
+	}
+}
+
+func (a *adaptive) bound(frequency time.Duration) time.Duration {
+	if frequency < a.min {
+		return a.min
+	}
+	if frequency > a.max {
+		return a.max
+	}
+	return frequency
+}
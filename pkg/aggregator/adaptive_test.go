@@ -0,0 +1,57 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+// feed returns articles with `guids`
+func feed(guids ...string) []storage.Article {
+	result := []storage.Article{}
+	for _, guid := range guids {
+		result = append(result, storage.Article{GUID: guid})
+	}
+	return result
+}
+
+func TestAdaptiveNext(t *testing.T) {
+	const min, max = time.Minute, time.Hour
+	tests := []struct {
+		name      string
+		frequency time.Duration
+		// previous is the feed at the poll before, nil if there wasn't one
+		previous []storage.Article
+		articles []storage.Article
+		want     time.Duration
+	}{
+		{"first poll", 10 * time.Minute, nil, feed("a", "b"), 10 * time.Minute},
+		{"first poll not modified", 10 * time.Minute, nil, nil, 10 * time.Minute},
+		{"new articles speed up", 10 * time.Minute, feed("a"), feed("a", "b"), 5 * time.Minute},
+		{"nothing new slows down", 10 * time.Minute, feed("a", "b"), feed("b", "a"), 15 * time.Minute},
+		{"not modified slows down", 10 * time.Minute, feed("a"), nil, 15 * time.Minute},
+		{"empty feed slows down", 10 * time.Minute, feed("a"), feed(), 15 * time.Minute},
+		{"clamped to min", 90 * time.Second, feed("a"), feed("b"), min},
+		{"at min", min, feed("a"), feed("b"), min},
+		{"clamped to max", 50 * time.Minute, feed("a"), feed("a"), max},
+		{"at max", max, feed("a"), nil, max},
+		{"out of range is brought within it", 2 * time.Hour, feed("a"), feed("b"), max},
+		{"links identify articles without GUIDs", 10 * time.Minute,
+			[]storage.Article{{Link: "https://example.com/a"}},
+			[]storage.Article{{Link: "https://example.com/a"}}, 15 * time.Minute},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			a := newAdaptive(min, max)
+			if tc.previous != nil {
+				a.next(tc.frequency, tc.previous)
+			}
+			got := a.next(tc.frequency, tc.articles)
+			if got != tc.want {
+				t.Errorf("next(%s) = %s, want %s", tc.frequency, got, tc.want)
+			}
+		})
+	}
+}
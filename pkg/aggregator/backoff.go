@@ -0,0 +1,43 @@
+package aggregator
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// maxBackoff caps the delay between retries of a failing provider, unless its polling frequency is even longer
+	maxBackoff = 1 * time.Hour
+	// breakerThreshold is the number of consecutive failures after which polling of a provider is paused
+	breakerThreshold = 5
+	// breakerPause is how long polling is paused for. A single poll is then attempted, pausing again if it fails.
+	breakerPause = 6 * time.Hour
+)
+
+// backoff returns the delay before the next poll of a provider after `failures` consecutive failures. The polling
+// frequency is doubled for each failure, capped at `maxBackoff`, with up to 20% jitter added so that feeds sharing a
+// broken host don't retry in lockstep.
+func backoff(frequency time.Duration, failures int) time.Duration {
+	if failures <= 0 {
+		return frequency
+	}
+
+	limit := maxBackoff
+	if frequency > limit {
+		limit = frequency
+	}
+
+	delay := frequency
+	for i := 0; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	if delay <= 0 || delay > limit {
+		// Also guards against a zero frequency, which would never grow
+		delay = limit
+	}
+
+	if jitter := int64(delay / 5); jitter > 0 {
+		delay += time.Duration(rand.Int63n(jitter))
+	}
+	return delay
+}
@@ -0,0 +1,116 @@
+package aggregator
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name      string
+		frequency time.Duration
+		failures  int
+		want      time.Duration
+	}{
+		{"no failures", time.Minute, 0, time.Minute},
+		{"one failure", time.Minute, 1, 2 * time.Minute},
+		{"three failures", time.Minute, 3, 8 * time.Minute},
+		{"capped", time.Minute, 10, maxBackoff},
+		{"many failures", time.Minute, 1000, maxBackoff},
+		{"frequency over the cap", 2 * time.Hour, 3, 2 * time.Hour},
+		{"zero frequency", 0, 1, maxBackoff},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				got := backoff(tc.frequency, tc.failures)
+				max := tc.want + tc.want/5
+				if tc.failures == 0 {
+					// Polls that haven't failed aren't jittered
+					max = tc.want
+				}
+				if got < tc.want || got > max {
+					t.Fatalf("backoff(%s, %d) = %s, want between %s and %s", tc.frequency, tc.failures, got, tc.want, max)
+				}
+			}
+		})
+	}
+}
+
+// stubProvider is a NewsProvider whose feed is always empty
+type stubProvider struct{}
+
+func (stubProvider) Latest(ctx context.Context) ([]storage.Article, error) {
+	return nil, nil
+}
+
+func (stubProvider) PollingFrequency() time.Duration {
+	return time.Minute
+}
+
+// statusRecorder records the poll status saved by a job. Other provider repository methods aren't used.
+type statusRecorder struct {
+	storage.ProviderRepository
+	status storage.PollStatus
+	saves  int
+}
+
+func (r *statusRecorder) UpdatePollStatus(ctx context.Context, providerID string, status storage.PollStatus) error {
+	r.status = status
+	r.saves++
+	return nil
+}
+
+func TestRecordResultBreaker(t *testing.T) {
+	ctx := context.Background()
+	providers := &statusRecorder{}
+	prov := storage.Provider{ID: "1", Label: "Example", PollFrequencySeconds: 60}
+	job, err := NewJob(prov, stubProvider{}, nil, providers)
+	if err != nil {
+		t.Fatalf("NewJob() error = %v", err)
+	}
+
+	errPoll := errors.New("poll failed")
+	steps := []struct {
+		name         string
+		err          error
+		wantFailures int
+		wantPaused   bool
+		// wantDelay is the least the job waits before polling again, which is jittered by up to 20% when backing off
+		wantDelay time.Duration
+	}{
+		{"first failure", errPoll, 1, false, 2 * time.Minute},
+		{"second failure", errPoll, 2, false, 4 * time.Minute},
+		{"third failure", errPoll, 3, false, 8 * time.Minute},
+		{"fourth failure", errPoll, 4, false, 16 * time.Minute},
+		{"breaker opens", errPoll, breakerThreshold, true, breakerPause},
+		{"failure while open", errPoll, breakerThreshold + 1, true, breakerPause},
+		{"recovered", nil, 0, false, time.Minute},
+		{"failure after recovering", errPoll, 1, false, 2 * time.Minute},
+	}
+	for _, step := range steps {
+		delay := job.recordResult(ctx, step.err)
+		if job.status.ConsecutiveFailures != step.wantFailures {
+			t.Errorf("%s: ConsecutiveFailures = %d, want %d", step.name, job.status.ConsecutiveFailures, step.wantFailures)
+		}
+		if paused := !job.status.PausedUntil.IsZero(); paused != step.wantPaused {
+			t.Errorf("%s: PausedUntil = %s, want paused %t", step.name, job.status.PausedUntil, step.wantPaused)
+		}
+		// The next poll may be measured from now, so it can be a moment less than the frequency
+		min, max := step.wantDelay-time.Second, step.wantDelay+step.wantDelay/5
+		if delay < min || delay > max {
+			t.Errorf("%s: delay = %s, want between %s and %s", step.name, delay, min, max)
+		}
+		if providers.status != job.status {
+			t.Errorf("%s: saved status = %+v, want %+v", step.name, providers.status, job.status)
+		}
+	}
+	if providers.saves != len(steps) {
+		t.Errorf("status saved %d times, want once for each failure and the recovery", providers.saves)
+	}
+}
@@ -0,0 +1,147 @@
+package aggregator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+// AdminHandler implements the aggregator's admin HTTP API, used by operators to see what jobs are doing
+type AdminHandler struct {
+	admin  Admin
+	server *http.Server
+}
+
+// Admin defines the functionality required by the admin api
+type Admin interface {
+	JobStatuses() []JobStatus
+	JobStatus(providerID string) (JobStatus, error)
+	TriggerPoll(providerID string) error
+}
+
+// ErrorResponse is returned to requests that result in some error state such as bad request or internal server error
+type ErrorResponse struct {
+	Error string `json:"error,omitempty"`
+}
+
+// NewAdminHandler constructs a new instance of AdminHandler
+func NewAdminHandler(admin Admin, addr string) (AdminHandler, error) {
+	if admin == nil {
+		return AdminHandler{}, errors.New("admin is nil")
+	}
+
+	h := AdminHandler{
+		admin: admin,
+	}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/jobs", h.HandleGetJobs()).Methods(http.MethodGet)
+	r.HandleFunc("/jobs/{providerID}", h.HandleGetJob()).Methods(http.MethodGet)
+	r.HandleFunc("/jobs/{providerID}/poll", h.HandlePostPoll()).Methods(http.MethodPost)
+	r.StrictSlash(true)
+
+	h.server = &http.Server{
+		Handler:      r,
+		Addr:         addr,
+		WriteTimeout: 15 * time.Second,
+		ReadTimeout:  15 * time.Second,
+		IdleTimeout:  120 * time.Second,
+	}
+
+	return h, nil
+}
+
+// Start starts the underlying http server
+func (h *AdminHandler) Start() error {
+	err := h.server.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return errors.Wrap(err, "server ListenAndServe()")
+	}
+	return nil
+}
+
+// Stop stops the underlying http server
+func (h *AdminHandler) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+	err := h.server.Shutdown(ctx)
+	if err != nil {
+		return errors.Wrap(err, "server Shutdown()")
+	}
+	return nil
+}
+
+func (h *AdminHandler) returnError(err error, w http.ResponseWriter) {
+	statusCode := http.StatusInternalServerError
+	if _, ok := errors.Cause(err).(storage.ErrNotFound); ok {
+		statusCode = http.StatusNotFound
+	}
+	response := ErrorResponse{
+		Error: err.Error(),
+	}
+	w.WriteHeader(statusCode)
+	encodeErr := json.NewEncoder(w).Encode(response)
+	if encodeErr != nil {
+		log.Printf("ERROR: Unable to return error message to client. %s", err.Error())
+
+		// Gracefully fail to respond with structured error
+		w.Write([]byte(fmt.Sprintf("Error: %s", encodeErr.Error())))
+	}
+}
+
+func (h *AdminHandler) returnJSON(response interface{}, statusCode int, w http.ResponseWriter) {
+	w.WriteHeader(statusCode)
+	err := json.NewEncoder(w).Encode(response)
+	if err != nil {
+		log.Printf("ERROR: encoding response to client: %s", err.Error())
+	}
+}
+
+// HandleGetJobs returns the status of every running job
+func (h *AdminHandler) HandleGetJobs() http.HandlerFunc {
+	type Response struct {
+		Jobs []JobStatus `json:"jobs"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.returnJSON(Response{Jobs: h.admin.JobStatuses()}, http.StatusOK, w)
+	}
+}
+
+// HandleGetJob returns the status of the job for a single provider
+func (h *AdminHandler) HandleGetJob() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status, err := h.admin.JobStatus(mux.Vars(r)["providerID"])
+		if err != nil {
+			h.returnError(errors.Wrap(err, "get job status"), w)
+			return
+		}
+		h.returnJSON(status, http.StatusOK, w)
+	}
+}
+
+// HandlePostPoll makes the job for a provider poll immediately. The poll happens asynchronously, so the response is
+// `202 Accepted` and the outcome can be seen in the job's status.
+func (h *AdminHandler) HandlePostPoll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providerID := mux.Vars(r)["providerID"]
+		err := h.admin.TriggerPoll(providerID)
+		if err != nil {
+			h.returnError(errors.Wrap(err, "trigger poll"), w)
+			return
+		}
+		status, err := h.admin.JobStatus(providerID)
+		if err != nil {
+			h.returnError(errors.Wrap(err, "get job status"), w)
+			return
+		}
+		h.returnJSON(status, http.StatusAccepted, w)
+	}
+}
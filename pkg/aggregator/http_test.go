@@ -0,0 +1,91 @@
+package aggregator
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// fakeAdmin has a job for each of its statuses, and records the polls triggered
+type fakeAdmin struct {
+	statuses map[string]JobStatus
+	polled   []string
+}
+
+func (f *fakeAdmin) JobStatuses() []JobStatus {
+	result := []JobStatus{}
+	for _, status := range f.statuses {
+		result = append(result, status)
+	}
+	return result
+}
+
+func (f *fakeAdmin) JobStatus(providerID string) (JobStatus, error) {
+	status, exists := f.statuses[providerID]
+	if !exists {
+		return JobStatus{}, errNoJob(providerID)
+	}
+	return status, nil
+}
+
+func (f *fakeAdmin) TriggerPoll(providerID string) error {
+	if _, exists := f.statuses[providerID]; !exists {
+		return errNoJob(providerID)
+	}
+	f.polled = append(f.polled, providerID)
+	return nil
+}
+
+func TestAdminHandler(t *testing.T) {
+	status := JobStatus{ProviderID: "1", Label: "Example", State: JobRunning}
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantCode   int
+		wantStatus bool
+		wantPolled []string
+	}{
+		{"get job", http.MethodGet, "/jobs/1", http.StatusOK, true, nil},
+		{"get unknown job", http.MethodGet, "/jobs/2", http.StatusNotFound, false, nil},
+		{"poll", http.MethodPost, "/jobs/1/poll", http.StatusAccepted, true, []string{"1"}},
+		{"poll unknown job", http.MethodPost, "/jobs/2/poll", http.StatusNotFound, false, nil},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			admin := &fakeAdmin{statuses: map[string]JobStatus{"1": status}}
+			h, err := NewAdminHandler(admin, "")
+			if err != nil {
+				t.Fatalf("NewAdminHandler() error = %v", err)
+			}
+			w := httptest.NewRecorder()
+			h.server.Handler.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+
+			if w.Code != tc.wantCode {
+				t.Fatalf("status code = %d, want %d. Body=%s", w.Code, tc.wantCode, w.Body.String())
+			}
+			if tc.wantStatus {
+				var got JobStatus
+				err := json.NewDecoder(w.Body).Decode(&got)
+				if err != nil {
+					t.Fatalf("decode response error = %v", err)
+				}
+				if !reflect.DeepEqual(got, status) {
+					t.Errorf("response = %+v, want %+v", got, status)
+				}
+			} else {
+				var got ErrorResponse
+				err := json.NewDecoder(w.Body).Decode(&got)
+				if err != nil || got.Error == "" {
+					t.Errorf("response = %s, want an error", w.Body.String())
+				}
+			}
+			if !reflect.DeepEqual(admin.polled, tc.wantPolled) {
+				t.Errorf("polled %v, want %v", admin.polled, tc.wantPolled)
+			}
+		})
+	}
+}
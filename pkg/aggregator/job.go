@@ -2,70 +2,438 @@ package aggregator
 
 import (
 	"context"
+	"encoding/json"
 	"log"
+	"sync"
 	"time"
 
-	mobileapi "github.com/chackett/zignews/pkg/mobile-api"
-	"github.com/chackett/zignews/pkg/rssprovider"
+	"github.com/chackett/zignews/pkg/events"
+	"github.com/chackett/zignews/pkg/schedule"
 	"github.com/chackett/zignews/pkg/storage"
 	"github.com/pkg/errors"
 )
 
+// ErrNotModified is returned by `NewsProvider.Latest()` when the feed has not changed since the previous call
+var ErrNotModified = errors.New("feed not modified")
+
+// JobState describes what a job is currently doing
+type JobState string
+
+const (
+	// JobStarting is the state of a job that is waiting to poll for the first time
+	JobStarting JobState = "starting"
+	// JobRunning is the state of a job whose last poll succeeded
+	JobRunning JobState = "running"
+	// JobBackingOff is the state of a job whose last poll failed, including when polling is paused after repeated failures
+	JobBackingOff JobState = "backing-off"
+	// JobStopped is the state of a job that has been stopped
+	JobStopped JobState = "stopped"
+)
+
 // Job is a runnable task that will retrieve news articles
 type Job struct {
-	articleRepo storage.ArticleRepository
-	provider    NewsProvider
-	Label       string
-	chStop      chan struct{}
+	articleRepo  storage.ArticleRepository
+	providerRepo storage.ProviderRepository
+	provider     NewsProvider
+	ProviderID   string
+	Label        string
+	feedURL      string
+	// pollSchedule decides when the provider is polled, including quiet hours
+	pollSchedule *schedule.Schedule
+	// adaptive, if set, adjusts the poll frequency of the schedule to how often the feed publishes
+	adaptive *adaptive
+	// scheduler, if set, limits when the provider is fetched
+	scheduler *Scheduler
+	// msgBus, if set, is used to publish events for new and updated articles
+	msgBus events.Bus
+	// startDelay is waited before the first poll. It's used to spread load when many jobs are started together.
+	startDelay time.Duration
+	// ctx is cancelled to stop the job, which also aborts any in-flight fetch or save.
+	ctx    context.Context
+	cancel context.CancelFunc
+	// mu guards state, started, stats and writes to status and pollSchedule, which are read by the admin api
+	mu      sync.Mutex
+	state   JobState
+	started bool
+	stats   jobStats
+	chDone  chan struct{}
+	// chPoll triggers an immediate poll
+	chPoll chan struct{}
+	// fetchState is the last state persisted for a StatefulProvider
+	fetchState storage.FetchState
+	// status is the last poll status persisted for the provider
+	status storage.PollStatus
+}
+
+// jobStats are kept in memory for the admin api
+type jobStats struct {
+	lastPoll        time.Time
+	lastError       string
+	lastArticles    int
+	articlesFetched int
+	nextPoll        time.Time
+}
+
+// JobStatus is a snapshot of what a job is doing
+type JobStatus struct {
+	ProviderID string   `json:"providerID"`
+	Label      string   `json:"label"`
+	State      JobState `json:"state"`
+	// LastPoll is when the job last finished polling the provider
+	LastPoll time.Time `json:"lastPoll,omitempty"`
+	// LastError is the error from the last poll, empty if it succeeded
+	LastError string `json:"lastError,omitempty"`
+	// LastArticles is the number of articles received by the last poll
+	LastArticles int `json:"lastArticles"`
+	// ArticlesFetched is the total number of articles received since the job started
+	ArticlesFetched     int       `json:"articlesFetched"`
+	NextPoll            time.Time `json:"nextPoll,omitempty"`
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	PausedUntil         time.Time `json:"pausedUntil,omitempty"`
+	// PollFrequencySeconds is the time between polls, which changes with adaptive polling. It's zero for a cron schedule.
+	PollFrequencySeconds int `json:"pollFrequencySeconds,omitempty"`
 }
 
 // NewsProvider defines functionality to retrieve news articles
 type NewsProvider interface {
-	Latest() ([]storage.Article, error)
+	// Latest returns the latest articles. The context is cancelled when the job is stopped.
+	Latest(ctx context.Context) ([]storage.Article, error)
 	PollingFrequency() time.Duration
 }
 
-// NewJob returns a job based on the specified NewsProvider
-func NewJob(label string, provider NewsProvider, articleRepo storage.ArticleRepository) (Job, error) {
-	return Job{
-		Label:       label,
-		provider:    provider,
-		articleRepo: articleRepo,
-		chStop:      make(chan struct{}),
-	}, nil
+// StatefulProvider is optionally implemented by a NewsProvider that keeps state between calls to `Latest()`, such as
+// HTTP cache validators. The job persists the state with the provider once the articles it relates to are saved.
+type StatefulProvider interface {
+	FetchState() storage.FetchState
+	SetFetchState(state storage.FetchState)
 }
 
-// Start a job
+// NewJob returns a job for the stored provider `prov`, which is polled using the specified NewsProvider
+func NewJob(prov storage.Provider, provider NewsProvider, articleRepo storage.ArticleRepository, providerRepo storage.ProviderRepository) (*Job, error) {
+	pollSchedule, err := prov.PollSchedule()
+	if err != nil {
+		return nil, errors.Wrap(err, "poll schedule")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	j := &Job{
+		ProviderID:   prov.ID,
+		Label:        prov.Label,
+		feedURL:      prov.FeedURL,
+		pollSchedule: pollSchedule,
+		status:       prov.Status,
+		provider:     provider,
+		articleRepo:  articleRepo,
+		providerRepo: providerRepo,
+		ctx:          ctx,
+		cancel:       cancel,
+		state:        JobStarting,
+		chDone:       make(chan struct{}),
+		chPoll:       make(chan struct{}, 1),
+	}
+	if sp, ok := provider.(StatefulProvider); ok {
+		j.fetchState = sp.FetchState()
+	}
+	if prov.Adaptive {
+		j.adaptive = newAdaptive(prov.PollFrequencyBounds())
+	}
+	return j, nil
+}
+
+// Start a job. It blocks until the job is stopped, and a job can't be started again once stopped.
 func (j *Job) Start() error {
+	j.mu.Lock()
+	if j.ctx.Err() != nil {
+		j.mu.Unlock()
+		return errors.New("job has been stopped")
+	}
+	if j.started {
+		j.mu.Unlock()
+		return errors.New("job is already running")
+	}
+	j.started = true
+	j.mu.Unlock()
+	defer close(j.chDone)
+	defer j.setState(JobStopped)
+
 	log.Printf("Starting job: %s", j.Label)
+	delay := j.startDelay
+	if paused := time.Until(j.status.PausedUntil); paused > delay {
+		j.setState(JobBackingOff)
+		log.Printf("%s - Paused until %s", j.Label, j.status.PausedUntil.Format(time.RFC3339))
+		delay = paused
+	}
+	if until, quiet := j.pollSchedule.PausedUntil(time.Now()); quiet && time.Until(until) > delay {
+		log.Printf("%s - Quiet hours until %s", j.Label, until.Format(time.RFC3339))
+		delay = time.Until(until)
+	}
+	j.setNextPoll(delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
 	for {
 		select {
-		case <-j.chStop:
+		case <-j.ctx.Done():
 			log.Printf("Stopping job: %s", j.Label)
 			return nil
-		default:
-			latest, err := j.provider.Latest()
-			if err != nil {
-				log.Print(errors.Wrapf(err, "%s - get latest - %s", j.Label, err.Error()))
-			}
-			log.Printf("%s - Received %d articles", j.Label, len(latest))
-			_, err = j.articleRepo.InsertArticles(context.Background(), latest)
-			if err != nil {
-				log.Printf("ERROR: Saving articles - Job: %s Error: %s", j.Label, err.Error())
+		case <-timer.C:
+		case <-j.chPoll:
+			log.Printf("%s - Poll triggered", j.Label)
+			if !timer.Stop() {
+				// Drain the timer in case it fired at the same time
+				select {
+				case <-timer.C:
+				default:
+				}
 			}
-			time.Sleep(j.provider.PollingFrequency())
 		}
+
+		err := j.poll(j.ctx)
+		if j.ctx.Err() != nil {
+			// Stopped mid-poll, the next iteration will exit
+			continue
+		}
+		delay := j.recordResult(j.ctx, err)
+		j.setNextPoll(delay)
+		timer.Reset(delay)
+	}
+}
+
+// TriggerPoll makes the job poll immediately, even if it's backing off. It doesn't wait for the poll to happen.
+func (j *Job) TriggerPoll() {
+	select {
+	case j.chPoll <- struct{}{}:
+	default:
+		// A poll is already pending
+	}
+}
+
+// Status returns a snapshot of what the job is doing
+func (j *Job) Status() JobStatus {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return JobStatus{
+		ProviderID:           j.ProviderID,
+		Label:                j.Label,
+		State:                j.state,
+		LastPoll:             j.stats.lastPoll,
+		LastError:            j.stats.lastError,
+		LastArticles:         j.stats.lastArticles,
+		ArticlesFetched:      j.stats.articlesFetched,
+		NextPoll:             j.stats.nextPoll,
+		ConsecutiveFailures:  j.status.ConsecutiveFailures,
+		PausedUntil:          j.status.PausedUntil,
+		PollFrequencySeconds: int(j.pollSchedule.Interval().Seconds()),
+	}
+}
+
+func (j *Job) setNextPoll(delay time.Duration) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.nextPoll = time.Now().Add(delay)
+}
+
+// recordPoll updates the stats with the outcome of a poll
+func (j *Job) recordPoll(articles int, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stats.lastPoll = time.Now()
+	j.stats.lastArticles = articles
+	j.stats.articlesFetched += articles
+	j.stats.lastError = ""
+	if err != nil {
+		j.stats.lastError = err.Error()
 	}
 }
 
-// Stop a job
+// Stop a job. If the job is running, Stop returns once the in-flight poll has been cancelled and the job has exited.
 func (j *Job) Stop() {
-	j.chStop <- struct{}{}
+	j.cancel()
+
+	j.mu.Lock()
+	started := j.started
+	if !started {
+		j.state = JobStopped
+	}
+	j.mu.Unlock()
+	if started {
+		<-j.chDone
+	}
+}
+
+// State returns what the job is currently doing
+func (j *Job) State() JobState {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.state
+}
+
+func (j *Job) setState(state JobState) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.state = state
+}
+
+// poll fetches and saves the latest articles. The returned error is a failure to fetch from the provider, which counts
+// towards backing off. Failing to save articles is logged but doesn't count against the provider.
+func (j *Job) poll(ctx context.Context) error {
+	latest, err := j.latest(ctx)
+	if errors.Cause(err) == ErrNotModified {
+		log.Printf("%s - Not modified", j.Label)
+		j.recordPoll(0, nil)
+		j.adapt(ctx, nil)
+		return nil
+	}
+	if err != nil {
+		err = errors.Wrap(err, "get latest")
+		j.recordPoll(0, err)
+		return err
+	}
+	log.Printf("%s - Received %d articles", j.Label, len(latest))
+	if latest == nil {
+		latest = []storage.Article{}
+	}
+	j.adapt(ctx, latest)
+	for i := range latest {
+		latest[i].ProviderID = j.ProviderID
+		latest[i].ID = storage.ArticleID(j.ProviderID, latest[i].GUID)
+	}
+	inserted, err := j.articleRepo.InsertArticles(ctx, latest)
+	if err != nil {
+		log.Printf("ERROR: Saving articles - Job: %s Error: %s", j.Label, err.Error())
+		err = errors.Wrap(err, "save articles")
+	}
+	// Some articles may have been saved even if others failed
+	j.publish(events.NewNewsItem, inserted.Inserted)
+	j.publish(events.ArticleUpdated, inserted.Modified)
+	j.recordPoll(len(latest), err)
+	j.saveFetchState(ctx, err == nil)
+	return nil
+}
+
+// publish sends an article event for `articleIDs`, if there are any
+func (j *Job) publish(subject string, articleIDs []string) {
+	if j.msgBus == nil || len(articleIDs) == 0 {
+		return
+	}
+	msg, err := json.Marshal(events.Articles{
+		ProviderID: j.ProviderID,
+		Provider:   j.Label,
+		ArticleIDs: articleIDs,
+	})
+	if err != nil {
+		log.Printf("ERROR: Encoding `%s` message - Job: %s Error: %s", subject, j.Label, err.Error())
+		return
+	}
+	err = j.msgBus.Publish(subject, msg)
+	if err != nil {
+		log.Printf("ERROR: Publish `%s` message to queue - Job: %s Error: %s", subject, j.Label, err.Error())
+	}
+}
+
+// adapt adjusts the poll frequency for adaptive polling, based on the `articles` received by a poll. Articles are nil
+// if the feed was not modified. The learned frequency is persisted so it isn't lost when the job restarts.
+func (j *Job) adapt(ctx context.Context, articles []storage.Article) {
+	if j.adaptive == nil {
+		return
+	}
+	current := j.pollSchedule.Interval()
+	frequency := j.adaptive.next(current, articles)
+	if frequency == current {
+		return
+	}
+	log.Printf("%s - Adaptive poll frequency changed from %s to %s", j.Label, current, frequency)
+	j.mu.Lock()
+	j.pollSchedule = j.pollSchedule.WithInterval(frequency)
+	j.mu.Unlock()
+	err := j.providerRepo.UpdateLearnedPollFrequency(ctx, j.ProviderID, int(frequency.Seconds()))
+	if err != nil {
+		log.Printf("ERROR: Saving learned poll frequency - Job: %s Error: %s", j.Label, err.Error())
+	}
+}
+
+// latest gets the latest articles from the provider, going through the scheduler if there is one
+func (j *Job) latest(ctx context.Context) ([]storage.Article, error) {
+	if j.scheduler == nil {
+		return j.provider.Latest(ctx)
+	}
+	var latest []storage.Article
+	err := j.scheduler.Do(ctx, j.feedURL, func(ctx context.Context) error {
+		var err error
+		latest, err = j.provider.Latest(ctx)
+		return err
+	})
+	return latest, err
+}
+
+// recordResult updates the poll status of the provider based on the outcome of a poll, and returns how long to wait
+// before polling again. After a success that's the time until the next scheduled poll. Consecutive failures back off
+// exponentially from it, and after `breakerThreshold` failures polling is paused for `breakerPause`.
+func (j *Job) recordResult(ctx context.Context, pollErr error) time.Duration {
+	frequency := time.Until(j.pollSchedule.Next(time.Now()))
+	if pollErr == nil {
+		j.setState(JobRunning)
+		if j.status.ConsecutiveFailures > 0 {
+			log.Printf("%s - Recovered after %d consecutive failures", j.Label, j.status.ConsecutiveFailures)
+			j.saveStatus(ctx, storage.PollStatus{})
+		}
+		return frequency
+	}
+
+	j.setState(JobBackingOff)
+	status := j.status
+	status.ConsecutiveFailures++
+	status.LastError = pollErr.Error()
+	status.LastFailure = time.Now()
+	status.PausedUntil = time.Time{}
+
+	delay := backoff(frequency, status.ConsecutiveFailures)
+	if status.ConsecutiveFailures >= breakerThreshold {
+		delay = breakerPause
+		status.PausedUntil = status.LastFailure.Add(delay)
+		log.Printf("ERROR: %s - %s - Paused until %s after %d consecutive failures", j.Label, pollErr.Error(), status.PausedUntil.Format(time.RFC3339), status.ConsecutiveFailures)
+	} else {
+		log.Printf("ERROR: %s - %s - Retrying in %s", j.Label, pollErr.Error(), delay)
+	}
+	j.saveStatus(ctx, status)
+	return delay
+}
+
+func (j *Job) saveStatus(ctx context.Context, status storage.PollStatus) {
+	// Keep the status in memory even if it can't be saved, so backing off still works
+	j.mu.Lock()
+	j.status = status
+	j.mu.Unlock()
+	err := j.providerRepo.UpdatePollStatus(ctx, j.ProviderID, status)
+	if err != nil {
+		log.Printf("ERROR: Saving poll status - Job: %s Error: %s", j.Label, err.Error())
+	}
+}
+
+// saveFetchState persists the fetch state of a StatefulProvider if it has changed. When the articles were not saved the
+// provider is rolled back to the persisted state, otherwise the next fetch could be "not modified" and they'd be lost.
+func (j *Job) saveFetchState(ctx context.Context, articlesSaved bool) {
+	sp, ok := j.provider.(StatefulProvider)
+	if !ok {
+		return
+	}
+	if !articlesSaved {
+		sp.SetFetchState(j.fetchState)
+		return
+	}
+	state := sp.FetchState()
+	if state == j.fetchState {
+		return
+	}
+	err := j.providerRepo.UpdateFetchState(ctx, j.ProviderID, state)
+	if err != nil {
+		log.Printf("ERROR: Saving fetch state - Job: %s Error: %s", j.Label, err.Error())
+		return
+	}
+	j.fetchState = state
 }
 
 // BuildJobs take an instance of `storage.ProviderRepository` and will return a slice of `Job`
 // based on all valid providers that are available
-func BuildJobs(provRepo storage.ProviderRepository, artRepo storage.ArticleRepository) ([]Job, error) {
+func BuildJobs(provRepo storage.ProviderRepository, artRepo storage.ArticleRepository) ([]*Job, error) {
 	offset := 0
 	count := 99999
 	providers, err := provRepo.GetProviders(context.Background(), offset, count)
@@ -73,24 +441,15 @@ func BuildJobs(provRepo storage.ProviderRepository, artRepo storage.ArticleRepos
 		return nil, errors.Wrap(err, "get providers")
 	}
 
-	var result []Job
+	var result []*Job
 
 	for _, prov := range providers {
-		if _, ok := mobileapi.SupportedProviders[prov.Type]; !ok {
-			log.Printf("Skipping provider `%s` - type `%s` not supported", prov.Label, prov.Type)
-			continue
-		}
-
-		// A hack, creating RSS provider as I know only RSS is supported - Need to make this dynamic when others are supported.
-		// Will use the supported providers map to expose a factory function.
-
-		pollingFrequency := time.Duration(time.Second * time.Duration(prov.PollFrequencySeconds))
-		p, err := rssprovider.NewRSSProvider(prov.Label, prov.FeedURL, pollingFrequency)
+		p, err := NewProvider(prov)
 		if err != nil {
-			log.Printf("ERROR: Unable to create RSSProvider - %s", err.Error())
+			log.Printf("Skipping provider `%s` - %s", prov.Label, err.Error())
 			continue
 		}
-		j, err := NewJob(p.Label, p, artRepo)
+		j, err := NewJob(prov, p, artRepo, provRepo)
 		if err != nil {
 			log.Printf("ERROR: Unable to create new Job - %s", err.Error())
 			continue
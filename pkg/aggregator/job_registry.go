@@ -0,0 +1,132 @@
+package aggregator
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/chackett/zignews/pkg/events"
+	"github.com/pkg/errors"
+)
+
+// errJobExists is returned when starting a job for a provider that already has one
+var errJobExists = errors.New("a job is already running for the provider")
+
+// jobRegistry holds the running jobs, keyed by provider ID. It's the only place jobs are started and stopped, so there's
+// at most one job per provider and every job is stopped when the aggregator stops.
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*Job
+	// scheduler is given to every job that's started
+	scheduler *Scheduler
+	// msgBus is given to every job that's started, to publish article events
+	msgBus events.Bus
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		jobs: map[string]*Job{},
+	}
+}
+
+// start starts `job` in a new goroutine, unless a job for the same provider is already registered
+func (r *jobRegistry) start(job *Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.jobs[job.ProviderID]; exists {
+		return errors.Wrapf(errJobExists, "provider `%s`", job.ProviderID)
+	}
+	r.jobs[job.ProviderID] = job
+	r.run(job)
+	return nil
+}
+
+// run gives `job` the registry's scheduler and message bus, and starts it in a new goroutine
+func (r *jobRegistry) run(job *Job) {
+	job.scheduler = r.scheduler
+	job.msgBus = r.msgBus
+
+	go func() {
+		err := job.Start()
+		if err != nil {
+			log.Printf("ERROR: Starting job `%s`. Error=%s", job.Label, err.Error())
+		}
+	}()
+}
+
+// stop stops and removes the job for the provider related to `providerID`. It returns false if there was no such job.
+func (r *jobRegistry) stop(providerID string) bool {
+	r.mu.Lock()
+	job, exists := r.jobs[providerID]
+	delete(r.jobs, providerID)
+	r.mu.Unlock()
+
+	if !exists {
+		return false
+	}
+	// Stopping waits for the job to exit, so it's done without holding the lock
+	job.Stop()
+	return true
+}
+
+// replace swaps the job for the same provider with `job`, stopping the old job and starting the new one. It returns
+// false, and doesn't start `job`, if there's no job for the provider, such as when it has been stopped meanwhile.
+func (r *jobRegistry) replace(job *Job) bool {
+	r.mu.Lock()
+	old, exists := r.jobs[job.ProviderID]
+	if !exists {
+		r.mu.Unlock()
+		return false
+	}
+	r.jobs[job.ProviderID] = job
+	r.mu.Unlock()
+
+	// The old job is stopped first so the provider isn't polled by both. Stopping is done without holding the lock, and
+	// if `job` is stopped meanwhile it exits as soon as it starts.
+	old.Stop()
+	r.run(job)
+	return true
+}
+
+// stopAll stops and removes every job. Jobs are stopped concurrently, so the time taken is bounded by the slowest.
+func (r *jobRegistry) stopAll() {
+	r.mu.Lock()
+	jobs := r.jobs
+	r.jobs = map[string]*Job{}
+	r.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job *Job) {
+			defer wg.Done()
+			job.Stop()
+		}(job)
+	}
+	wg.Wait()
+}
+
+// get returns the job for the provider related to `providerID`
+func (r *jobRegistry) get(providerID string) (*Job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	job, exists := r.jobs[providerID]
+	return job, exists
+}
+
+// list returns all of the registered jobs, ordered by label
+func (r *jobRegistry) list() []*Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := make([]*Job, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		result = append(result, job)
+	}
+	sort.Slice(result, func(i, k int) bool {
+		return result[i].Label < result[k].Label
+	})
+	return result
+}
@@ -0,0 +1,126 @@
+package aggregator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// newIdleJob returns a job for the provider related to `providerID` that doesn't poll during a test
+func newIdleJob(t *testing.T, providerID string) *Job {
+	t.Helper()
+	prov := storage.Provider{ID: providerID, Label: "Provider " + providerID, PollFrequencySeconds: 60}
+	job, err := NewJob(prov, stubProvider{}, nil, &statusRecorder{})
+	if err != nil {
+		t.Fatalf("NewJob() error = %v", err)
+	}
+	job.startDelay = time.Hour
+	return job
+}
+
+func TestJobRegistryStartDuplicate(t *testing.T) {
+	r := newJobRegistry()
+	defer r.stopAll()
+	first := newIdleJob(t, "1")
+	err := r.start(first)
+	if err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	duplicate := newIdleJob(t, "1")
+	err = r.start(duplicate)
+	if errors.Cause(err) != errJobExists {
+		t.Errorf("start() of a duplicate error = %v, want errJobExists", err)
+	}
+	if job, _ := r.get("1"); job != first {
+		t.Errorf("get() returned the duplicate, want the first job")
+	}
+	if state := duplicate.State(); state != JobStarting {
+		t.Errorf("duplicate state = %s, want it not started", state)
+	}
+}
+
+func TestJobRegistryStop(t *testing.T) {
+	r := newJobRegistry()
+	job := newIdleJob(t, "1")
+	err := r.start(job)
+	if err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+
+	if r.stop("unknown") {
+		t.Errorf("stop() of an unknown provider = true, want false")
+	}
+	if _, exists := r.get("1"); !exists {
+		t.Errorf("stop() of an unknown provider removed another job")
+	}
+
+	if !r.stop("1") {
+		t.Errorf("stop() = false, want true")
+	}
+	if state := job.State(); state != JobStopped {
+		t.Errorf("state = %s, want %s", state, JobStopped)
+	}
+	if _, exists := r.get("1"); exists {
+		t.Errorf("get() found the stopped job")
+	}
+	if r.stop("1") {
+		t.Errorf("stop() of a stopped job = true, want false")
+	}
+}
+
+func TestJobRegistryStopAll(t *testing.T) {
+	r := newJobRegistry()
+	var jobs []*Job
+	for _, providerID := range []string{"1", "2", "3"} {
+		job := newIdleJob(t, providerID)
+		err := r.start(job)
+		if err != nil {
+			t.Fatalf("start() error = %v", err)
+		}
+		jobs = append(jobs, job)
+	}
+
+	r.stopAll()
+	for _, job := range jobs {
+		if state := job.State(); state != JobStopped {
+			t.Errorf("job `%s` state = %s, want %s", job.ProviderID, state, JobStopped)
+		}
+	}
+	if got := r.list(); len(got) != 0 {
+		t.Errorf("list() = %d jobs, want none", len(got))
+	}
+	// Stopping again is harmless
+	r.stopAll()
+}
+
+func TestJobRegistryReplace(t *testing.T) {
+	r := newJobRegistry()
+	defer r.stopAll()
+
+	unregistered := newIdleJob(t, "1")
+	if r.replace(unregistered) {
+		t.Errorf("replace() without a job = true, want false")
+	}
+	if _, exists := r.get("1"); exists {
+		t.Errorf("replace() without a job registered it")
+	}
+
+	old := newIdleJob(t, "1")
+	err := r.start(old)
+	if err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	replacement := newIdleJob(t, "1")
+	if !r.replace(replacement) {
+		t.Fatalf("replace() = false, want true")
+	}
+	if state := old.State(); state != JobStopped {
+		t.Errorf("old job state = %s, want %s", state, JobStopped)
+	}
+	if job, _ := r.get("1"); job != replacement {
+		t.Errorf("get() didn't return the replacement")
+	}
+}
@@ -0,0 +1,212 @@
+package aggregator
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	// leasePrefixInstance prefixes the leases that each aggregator instance holds while it's alive
+	leasePrefixInstance = "aggregator-instance/"
+	// leasePrefixProvider prefixes the leases giving an aggregator instance ownership of a provider
+	leasePrefixProvider = "aggregator-provider/"
+)
+
+// ownership splits providers between the running aggregator instances using leases in a shared store. Every instance
+// holds a lease to show it's alive, and a lease for each provider it polls. Leases are renewed three times per TTL, so
+// when an instance dies its providers move to the live instances once their leases expire.
+type ownership struct {
+	leases     storage.LeaseRepository
+	instanceID string
+	ttl        time.Duration
+	cancel     context.CancelFunc
+	chDone     chan struct{}
+}
+
+// UseLeases makes the aggregator share providers with the other instances using `leases`. Rather than running the jobs
+// passed to `NewAggregator()`, each instance runs jobs for its share of the providers. It must be called before Start.
+func (a *Aggregator) UseLeases(leases storage.LeaseRepository, instanceID string, ttl time.Duration) error {
+	if leases == nil {
+		return errors.New("lease repository is nil")
+	}
+	if instanceID == "" {
+		return errors.New("instance ID is required")
+	}
+	if ttl <= 0 {
+		return errors.New("lease ttl must be positive")
+	}
+	a.ownership = &ownership{
+		leases:     leases,
+		instanceID: instanceID,
+		ttl:        ttl,
+	}
+	return nil
+}
+
+// runOwnership keeps the leases up to date until the aggregator is stopped
+func (a *Aggregator) runOwnership() {
+	o := a.ownership
+	ctx, cancel := context.WithCancel(context.Background())
+	o.cancel = cancel
+	o.chDone = make(chan struct{})
+
+	go func() {
+		defer close(o.chDone)
+		ticker := time.NewTicker(o.ttl / 3)
+		defer ticker.Stop()
+		for {
+			err := a.reconcileOwnership(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("ERROR: Reconcile provider ownership - %s", err.Error())
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopOwnership stops renewing leases, stops the jobs and releases the leases so other instances can take over the
+// providers straight away
+func (a *Aggregator) stopOwnership() {
+	o := a.ownership
+	if o.cancel != nil {
+		o.cancel()
+		<-o.chDone
+	}
+
+	jobs := a.jobs.list()
+	a.jobs.stopAll()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, job := range jobs {
+		a.releaseProvider(ctx, job.ProviderID)
+	}
+	err := o.leases.ReleaseLease(ctx, leasePrefixInstance+o.instanceID, o.instanceID)
+	if err != nil {
+		log.Printf("ERROR: Release instance lease - %s", err.Error())
+	}
+}
+
+// reconcileOwnership renews this instance's leases, and starts or stops jobs so that it runs its fair share of the
+// providers
+func (a *Aggregator) reconcileOwnership(ctx context.Context) error {
+	o := a.ownership
+
+	_, err := o.leases.AcquireLease(ctx, leasePrefixInstance+o.instanceID, o.instanceID, o.ttl)
+	if err != nil {
+		return errors.Wrap(err, "renew instance lease")
+	}
+	instances, err := o.leases.GetLeases(ctx, leasePrefixInstance)
+	if err != nil {
+		return errors.Wrap(err, "get instance leases")
+	}
+	providers, err := a.providers.GetProviders(ctx, 0, 99999)
+	if err != nil {
+		return errors.Wrap(err, "get providers")
+	}
+
+	liveInstances := len(instances)
+	if liveInstances < 1 {
+		liveInstances = 1
+	}
+	share := (len(providers) + liveInstances - 1) / liveInstances
+
+	exists := map[string]bool{}
+	for _, p := range providers {
+		exists[p.ID] = true
+	}
+
+	// Renew the leases of running jobs. Jobs over our share are handed back, which happens when another instance joins.
+	jobs := a.jobs.list()
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].ProviderID < jobs[k].ProviderID
+	})
+	owned := 0
+	for _, job := range jobs {
+		if !exists[job.ProviderID] || owned >= share {
+			a.jobs.stop(job.ProviderID)
+			a.releaseProvider(ctx, job.ProviderID)
+			continue
+		}
+		held, err := o.leases.AcquireLease(ctx, leasePrefixProvider+job.ProviderID, o.instanceID, o.ttl)
+		if err != nil {
+			// Keep polling, the lease may still be renewed before it expires
+			log.Printf("ERROR: Renew lease for provider `%s` - %s", job.Label, err.Error())
+			owned++
+			continue
+		}
+		if !held {
+			log.Printf("Lost lease for provider `%s` to another instance", job.Label)
+			a.jobs.stop(job.ProviderID)
+			continue
+		}
+		owned++
+	}
+
+	// Take on providers nobody owns, up to our share. Shuffled so instances starting together don't contend for the
+	// same providers.
+	rand.Shuffle(len(providers), func(i, k int) {
+		providers[i], providers[k] = providers[k], providers[i]
+	})
+	for _, p := range providers {
+		if owned >= share {
+			break
+		}
+		if _, running := a.jobs.get(p.ID); running {
+			continue
+		}
+		held, err := o.leases.AcquireLease(ctx, leasePrefixProvider+p.ID, o.instanceID, o.ttl)
+		if err != nil {
+			log.Printf("ERROR: Acquire lease for provider `%s` - %s", p.Label, err.Error())
+			continue
+		}
+		if !held {
+			continue
+		}
+		job, err := a.newJob(p)
+		if err != nil {
+			log.Printf("ERROR: Build job for provider `%s` - %s", p.Label, err.Error())
+			a.releaseProvider(ctx, p.ID)
+			continue
+		}
+		job.startDelay = a.delay()
+		err = a.jobs.start(job)
+		if err != nil {
+			log.Printf("ERROR: Start job `%s` - %s", job.Label, err.Error())
+			continue
+		}
+		owned++
+	}
+
+	return nil
+}
+
+// acquireProvider takes the lease for a provider, so the job can be started by this instance. It always succeeds when
+// leases aren't in use.
+func (a *Aggregator) acquireProvider(ctx context.Context, providerID string) (bool, error) {
+	if a.ownership == nil {
+		return true, nil
+	}
+	return a.ownership.leases.AcquireLease(ctx, leasePrefixProvider+providerID, a.ownership.instanceID, a.ownership.ttl)
+}
+
+// releaseProvider gives up the lease for a provider, if leases are in use
+func (a *Aggregator) releaseProvider(ctx context.Context, providerID string) {
+	if a.ownership == nil {
+		return
+	}
+	err := a.ownership.leases.ReleaseLease(ctx, leasePrefixProvider+providerID, a.ownership.instanceID)
+	if err != nil {
+		log.Printf("ERROR: Release lease for provider `%s` - %s", providerID, err.Error())
+	}
+}
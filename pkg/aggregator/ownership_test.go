@@ -0,0 +1,125 @@
+package aggregator
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/chackett/zignews/pkg/storage/memory"
+)
+
+// stubProviderType is the provider type built by stubFactory
+const stubProviderType = "stub"
+
+// stubFactory builds a stubProvider for every provider
+type stubFactory struct{}
+
+func (stubFactory) Validate(provider storage.Provider) error {
+	return nil
+}
+
+func (stubFactory) New(provider storage.Provider) (NewsProvider, error) {
+	return stubProvider{}, nil
+}
+
+func init() {
+	RegisterProvider(stubProviderType, stubFactory{})
+}
+
+// expire is a reconcile step that waits for the leases of the instance with the shortest ttl to expire
+const expire = -1
+
+func TestReconcileOwnership(t *testing.T) {
+	const providerCount = 4
+	tests := []struct {
+		name string
+		ttls [2]time.Duration
+		// steps are the instances that reconcile, in order
+		steps []int
+		// want is the number of jobs each instance runs after the steps
+		want [2]int
+	}{
+		{"alone", [2]time.Duration{time.Hour, time.Hour}, []int{0}, [2]int{4, 0}},
+		{"join", [2]time.Duration{time.Hour, time.Hour}, []int{0, 1}, [2]int{4, 0}},
+		{"handback when an instance joins", [2]time.Duration{time.Hour, time.Hour}, []int{0, 1, 0}, [2]int{2, 0}},
+		{"split", [2]time.Duration{time.Hour, time.Hour}, []int{0, 1, 0, 1}, [2]int{2, 2}},
+		{"split is stable", [2]time.Duration{time.Hour, time.Hour}, []int{0, 1, 0, 1, 0, 1}, [2]int{2, 2}},
+		// The first instance's leases expire as if it had died, then it finds its jobs have been taken
+		{"takeover after leases expire", [2]time.Duration{20 * time.Millisecond, time.Hour}, []int{0, 1, expire, 1, 0}, [2]int{0, 4}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			providers := memory.NewProviderRepository()
+			articles := memory.NewArticleRepository()
+			leases := memory.NewLeaseRepository()
+			var toInsert []storage.Provider
+			for i := 0; i < providerCount; i++ {
+				toInsert = append(toInsert, storage.Provider{
+					Type:                 stubProviderType,
+					Label:                fmt.Sprintf("Provider %d", i),
+					PollFrequencySeconds: 3600,
+				})
+			}
+			_, err := providers.InsertProviders(ctx, toInsert)
+			if err != nil {
+				t.Fatalf("InsertProviders() error = %v", err)
+			}
+
+			var instances [2]*Aggregator
+			for i := range instances {
+				a, err := NewAggregator(nil, false, nil, providers, articles)
+				if err != nil {
+					t.Fatalf("NewAggregator() error = %v", err)
+				}
+				err = a.UseLeases(leases, fmt.Sprintf("instance-%d", i), tc.ttls[i])
+				if err != nil {
+					t.Fatalf("UseLeases() error = %v", err)
+				}
+				defer a.jobs.stopAll()
+				instances[i] = a
+			}
+
+			for _, step := range tc.steps {
+				if step == expire {
+					time.Sleep(2 * tc.ttls[0])
+					continue
+				}
+				err := instances[step].reconcileOwnership(ctx)
+				if err != nil {
+					t.Fatalf("instance %d reconcileOwnership() error = %v", step, err)
+				}
+			}
+
+			for i, a := range instances {
+				if got := len(a.jobs.list()); got != tc.want[i] {
+					t.Errorf("instance %d runs %d jobs, want %d", i, got, tc.want[i])
+				}
+			}
+			// Each instance holds the leases of exactly the providers it runs, so none are run twice
+			held, err := leases.GetLeases(ctx, leasePrefixProvider)
+			if err != nil {
+				t.Fatalf("GetLeases() error = %v", err)
+			}
+			for i, a := range instances {
+				want := map[string]bool{}
+				for _, job := range a.jobs.list() {
+					want[leasePrefixProvider+job.ProviderID] = true
+				}
+				got := map[string]bool{}
+				for _, l := range held {
+					if l.Owner == a.ownership.instanceID {
+						got[l.Name] = true
+					}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("instance %d holds leases %v, want %v", i, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package aggregator
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// ProviderFactory builds instances of a single "type" of news provider from stored provider configuration
+type ProviderFactory interface {
+	// Validate checks that the provider configuration is usable by this type of provider
+	Validate(provider storage.Provider) error
+	// New returns a NewsProvider based on the provider configuration
+	New(provider storage.Provider) (NewsProvider, error)
+}
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]ProviderFactory{}
+)
+
+// RegisterProvider makes a provider factory available for the provider type `typ`. Provider implementations are
+// expected to call this from an `init()` function, so importing the package is enough to make the type supported.
+// It panics if called twice for the same type or if the factory is nil.
+func RegisterProvider(typ string, factory ProviderFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("aggregator: RegisterProvider factory is nil")
+	}
+	if _, dup := factories[typ]; dup {
+		panic(fmt.Sprintf("aggregator: RegisterProvider called twice for type `%s`", typ))
+	}
+	factories[typ] = factory
+}
+
+// SupportedProviders returns a sorted list of the provider types that have been registered
+func SupportedProviders() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	var result []string
+	for typ := range factories {
+		result = append(result, typ)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// ValidateProvider checks that `provider` has a valid schedule, that its type is supported and that its configuration is
+// valid for that type
+func ValidateProvider(provider storage.Provider) error {
+	err := provider.Validate()
+	if err != nil {
+		return err
+	}
+	factory, err := lookupFactory(provider.Type)
+	if err != nil {
+		return err
+	}
+	return factory.Validate(provider)
+}
+
+// NewProvider validates `provider` and returns a NewsProvider built by the factory registered for its type
+func NewProvider(provider storage.Provider) (NewsProvider, error) {
+	err := ValidateProvider(provider)
+	if err != nil {
+		return nil, errors.Wrapf(err, "validate `%s` provider", provider.Type)
+	}
+	factory, err := lookupFactory(provider.Type)
+	if err != nil {
+		return nil, err
+	}
+	p, err := factory.New(provider)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create `%s` provider", provider.Type)
+	}
+	return p, nil
+}
+
+func lookupFactory(typ string) (ProviderFactory, error) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	factory, ok := factories[typ]
+	if !ok {
+		return nil, fmt.Errorf("`%s` is an unsupported provider type", typ)
+	}
+	return factory, nil
+}
@@ -0,0 +1,182 @@
+package aggregator
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/chackett/zignews/pkg/archive"
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	// leaseRetention is held by the instance sweeping expired articles, when leases are in use
+	leaseRetention = "aggregator-retention"
+	// retentionBatchSize is the number of expired articles archived and deleted at a time
+	retentionBatchSize = 500
+)
+
+// retention removes articles once they're older than the retention policy of their provider, or the global one for
+// providers without their own. Articles are archived first, if there's an archive.
+type retention struct {
+	days     int
+	interval time.Duration
+	archive  *archive.Archive
+	cancel   context.CancelFunc
+	chDone   chan struct{}
+}
+
+// UseRetention makes the aggregator sweep expired articles every `interval`. Articles of providers without their own
+// retention policy expire `days` after they're ingested, or are kept forever if it's zero. Expired articles are written
+// to `arch` before they're deleted, unless it's nil. It must be called before Start.
+func (a *Aggregator) UseRetention(days int, interval time.Duration, arch *archive.Archive) error {
+	if days < 0 {
+		return errors.New("retention days must not be negative")
+	}
+	if interval <= 0 {
+		return errors.New("retention sweep interval must be positive")
+	}
+	a.retention = &retention{
+		days:     days,
+		interval: interval,
+		archive:  arch,
+	}
+	return nil
+}
+
+// runRetention sweeps expired articles now, then every interval until the aggregator is stopped
+func (a *Aggregator) runRetention() {
+	r := a.retention
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.chDone = make(chan struct{})
+
+	go func() {
+		defer close(r.chDone)
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			err := a.sweepExpired(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("ERROR: Sweep expired articles - %s", err.Error())
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// stopRetention stops sweeping, waiting for a sweep in progress to stop. The retention lease is released so another
+// instance can take over sweeping straight away.
+func (a *Aggregator) stopRetention() {
+	r := a.retention
+	if r.cancel != nil {
+		r.cancel()
+		<-r.chDone
+	}
+	if a.ownership == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := a.ownership.leases.ReleaseLease(ctx, leaseRetention, a.ownership.instanceID)
+	if err != nil {
+		log.Printf("ERROR: Release retention lease - %s", err.Error())
+	}
+}
+
+// sweepExpired archives and deletes the articles that have expired. When providers are shared between instances, only
+// the instance holding the retention lease sweeps.
+func (a *Aggregator) sweepExpired(ctx context.Context) error {
+	r := a.retention
+	if a.ownership != nil {
+		held, err := a.ownership.leases.AcquireLease(ctx, leaseRetention, a.ownership.instanceID, r.interval)
+		if err != nil {
+			return errors.Wrap(err, "acquire retention lease")
+		}
+		if !held {
+			return nil
+		}
+	}
+
+	providers, err := a.providers.GetProviders(ctx, 0, 99999)
+	if err != nil {
+		return errors.Wrap(err, "get providers")
+	}
+	now := time.Now()
+	var ownPolicy []string
+	for _, p := range providers {
+		if p.RetentionDays <= 0 {
+			continue
+		}
+		ownPolicy = append(ownPolicy, p.ID)
+		n, err := a.expire(ctx, storage.ExpiryQuery{
+			Before:      now.AddDate(0, 0, -p.RetentionDays),
+			ProviderIDs: []string{p.ID},
+		})
+		if err != nil {
+			return errors.Wrapf(err, "expire articles of provider `%s`", p.Label)
+		}
+		if n > 0 {
+			log.Printf("Removed %d articles of provider `%s` older than %d days", n, p.Label, p.RetentionDays)
+		}
+	}
+
+	if r.days > 0 {
+		// Articles of deleted providers expire under the global policy too
+		n, err := a.expire(ctx, storage.ExpiryQuery{
+			Before:             now.AddDate(0, 0, -r.days),
+			ExcludeProviderIDs: ownPolicy,
+		})
+		if err != nil {
+			return errors.Wrap(err, "expire articles")
+		}
+		if n > 0 {
+			log.Printf("Removed %d articles older than %d days", n, r.days)
+		}
+	}
+	return nil
+}
+
+// expire archives and deletes the articles selected by `query` in batches, returning how many were deleted
+func (a *Aggregator) expire(ctx context.Context, query storage.ExpiryQuery) (int, error) {
+	query.Count = retentionBatchSize
+	total := 0
+	for {
+		articles, err := a.articles.ExpiredArticles(ctx, query)
+		if err != nil {
+			return total, errors.Wrap(err, "get expired articles")
+		}
+		if len(articles) == 0 {
+			return total, nil
+		}
+		if a.retention.archive != nil {
+			err = a.retention.archive.Write(articles)
+			if err != nil {
+				return total, errors.Wrap(err, "archive articles")
+			}
+		}
+
+		ids := make([]string, len(articles))
+		for i, art := range articles {
+			ids[i] = art.ID
+		}
+		n, err := a.articles.DeleteArticles(ctx, ids)
+		if err != nil {
+			return total, errors.Wrap(err, "delete articles")
+		}
+		total += n
+		if n == 0 {
+			// Nothing would change by trying again
+			return total, errors.New("expired articles weren't deleted")
+		}
+		if len(articles) < query.Count {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package aggregator
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// UserAgent identifies the aggregator to the feeds' hosts, and is matched against the groups in robots.txt. Providers
+// send it with their requests.
+const UserAgent = "zignews"
+
+var robotsClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+// crawlDelay returns the `Crawl-delay` in the robots.txt of the host of `u` that applies to the aggregator. Zero is
+// returned if the host doesn't have a robots.txt or doesn't set a crawl delay.
+func crawlDelay(ctx context.Context, u *url.URL) (time.Duration, error) {
+	robotsURL := url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, robotsURL.String(), nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "build request")
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	resp, err := robotsClient.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "http get")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return 0, fmt.Errorf("unexpected http status %d", resp.StatusCode)
+	}
+
+	// robots.txt files are small, anything larger than this isn't one
+	return parseCrawlDelay(io.LimitReader(resp.Body, 512*1024), UserAgent)
+}
+
+// parseCrawlDelay finds the crawl delay for `agent` in a robots.txt. The group naming the agent takes precedence over the
+// `*` group.
+func parseCrawlDelay(r io.Reader, agent string) (time.Duration, error) {
+	var (
+		agentDelay, anyDelay time.Duration
+		agentFound           bool
+		// groupAgents are the user agents of the current group. A group starts with one or more User-agent lines.
+		groupAgents []string
+		inRules     bool
+	)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		field := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		switch field {
+		case "user-agent":
+			if inRules {
+				groupAgents = nil
+				inRules = false
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+		case "crawl-delay":
+			inRules = true
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			delay := time.Duration(seconds * float64(time.Second))
+			for _, a := range groupAgents {
+				switch {
+				case a == "*":
+					anyDelay = delay
+				case strings.Contains(strings.ToLower(agent), a):
+					agentDelay, agentFound = delay, true
+				}
+			}
+		default:
+			inRules = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, errors.Wrap(err, "read robots.txt")
+	}
+
+	if agentFound {
+		return agentDelay, nil
+	}
+	return anyDelay, nil
+}
@@ -0,0 +1,44 @@
+package aggregator
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCrawlDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		robots string
+		want   time.Duration
+	}{
+		{"empty", "", 0},
+		{"no crawl delay", "User-agent: *\nDisallow: /private\n", 0},
+		{"any agent", "User-agent: *\nCrawl-delay: 10\n", 10 * time.Second},
+		{"fractional", "User-agent: *\nCrawl-delay: 0.5\n", 500 * time.Millisecond},
+		{"named agent", "User-agent: zignews\nCrawl-delay: 30\n", 30 * time.Second},
+		{"named agent over any agent", "User-agent: *\nCrawl-delay: 10\n\nUser-agent: zignews\nCrawl-delay: 30\n", 30 * time.Second},
+		{"named agent before any agent", "User-agent: zignews\nCrawl-delay: 30\n\nUser-agent: *\nCrawl-delay: 10\n", 30 * time.Second},
+		{"other agent", "User-agent: googlebot\nCrawl-delay: 30\n", 0},
+		{"other agent and any agent", "User-agent: googlebot\nCrawl-delay: 30\n\nUser-agent: *\nCrawl-delay: 10\n", 10 * time.Second},
+		{"group of agents", "User-agent: googlebot\nUser-agent: zignews\nCrawl-delay: 20\n", 20 * time.Second},
+		{"group ends at rules", "User-agent: zignews\nDisallow: /private\nUser-agent: googlebot\nCrawl-delay: 20\n", 0},
+		{"case insensitive", "USER-AGENT: ZigNews\nCRAWL-DELAY: 5\n", 5 * time.Second},
+		{"comments and spaces", "# robots\n  User-agent : *   # everyone\n Crawl-delay :  7 # seconds\n", 7 * time.Second},
+		{"invalid delay", "User-agent: *\nCrawl-delay: soon\n", 0},
+		{"negative delay", "User-agent: *\nCrawl-delay: -5\n", 0},
+		{"crawl delay before any agent", "Crawl-delay: 5\nUser-agent: *\n", 0},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseCrawlDelay(strings.NewReader(tc.robots), UserAgent)
+			if err != nil {
+				t.Fatalf("parseCrawlDelay() error = %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("parseCrawlDelay() = %s, want %s", got, tc.want)
+			}
+		})
+	}
+}
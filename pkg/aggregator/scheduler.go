@@ -0,0 +1,121 @@
+package aggregator
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/time/rate"
+)
+
+// robotsTTL is how long the crawl delay from a host's robots.txt is used before it's fetched again
+const robotsTTL = 24 * time.Hour
+
+// Scheduler is shared by all jobs to limit how feeds are fetched. A global pool of workers bounds the number of fetches
+// in flight, and each host has a token bucket so feeds sharing a host aren't fetched at the same moment. A host can
+// slow fetching down further with a `Crawl-delay` in its robots.txt.
+type Scheduler struct {
+	workers       chan struct{}
+	hostInterval  time.Duration
+	hostBurst     int
+	respectRobots bool
+
+	mu    sync.Mutex
+	hosts map[string]*hostLimiter
+}
+
+// hostLimiter rate limits fetches from a single host
+type hostLimiter struct {
+	limiter *rate.Limiter
+	// mu guards robotsChecked, and is held while robots.txt is fetched so it's only fetched once
+	mu            sync.Mutex
+	robotsChecked time.Time
+}
+
+// NewScheduler returns a new instance of Scheduler. At most `workers` fetches run at once, and fetches from the same host
+// are spaced by `hostInterval` with bursts of up to `hostBurst`.
+func NewScheduler(workers int, hostInterval time.Duration, hostBurst int, respectRobots bool) (*Scheduler, error) {
+	if workers < 1 {
+		return nil, errors.New("at least one worker is required")
+	}
+	if hostInterval < 0 {
+		return nil, errors.New("host interval must not be negative")
+	}
+	if hostBurst < 1 {
+		return nil, errors.New("host burst must be at least one")
+	}
+	return &Scheduler{
+		workers:       make(chan struct{}, workers),
+		hostInterval:  hostInterval,
+		hostBurst:     hostBurst,
+		respectRobots: respectRobots,
+		hosts:         map[string]*hostLimiter{},
+	}, nil
+}
+
+// Do runs `fetch` once the host of `feedURL` allows it and a worker is free. It returns early with the context's error
+// if `ctx` is cancelled while waiting.
+func (s *Scheduler) Do(ctx context.Context, feedURL string, fetch func(ctx context.Context) error) error {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return errors.Wrap(err, "parse feed URL")
+	}
+
+	// Wait for the host before taking a worker, so a busy host doesn't hold up the rest
+	err = s.host(ctx, u).Wait(ctx)
+	if err != nil {
+		return errors.Wrap(err, "wait for host rate limit")
+	}
+
+	select {
+	case s.workers <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.workers }()
+
+	return fetch(ctx)
+}
+
+// host returns the rate limiter for the host of `u`, creating it and checking robots.txt as needed
+func (s *Scheduler) host(ctx context.Context, u *url.URL) *rate.Limiter {
+	s.mu.Lock()
+	h, ok := s.hosts[u.Host]
+	if !ok {
+		h = &hostLimiter{
+			limiter: rate.NewLimiter(rate.Every(s.hostInterval), s.hostBurst),
+		}
+		s.hosts[u.Host] = h
+	}
+	s.mu.Unlock()
+
+	if !s.respectRobots {
+		return h.limiter
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.robotsChecked) < robotsTTL {
+		return h.limiter
+	}
+	// Failing to get robots.txt, most often because there isn't one, isn't a reason not to fetch
+	delay, err := crawlDelay(ctx, u)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Unable to get crawl delay for `%s` - %s", u.Host, err.Error())
+	}
+	if ctx.Err() != nil {
+		return h.limiter
+	}
+	h.robotsChecked = time.Now()
+
+	interval, burst := s.hostInterval, s.hostBurst
+	if delay > interval {
+		interval, burst = delay, 1
+	}
+	h.limiter.SetLimit(rate.Every(interval))
+	h.limiter.SetBurst(burst)
+	return h.limiter
+}
@@ -7,31 +7,38 @@ import (
 	"math/rand"
 	"time"
 
-	"github.com/chackett/zignews/pkg/rssprovider"
 	"github.com/chackett/zignews/pkg/storage"
 
 	"github.com/chackett/zignews/pkg/events"
 	"github.com/pkg/errors"
-
-	"github.com/nats-io/nats.go"
 )
 
 // Aggregator orchestrates the creation and running of aggregation jobs
 type Aggregator struct {
-	jobs           []Job
-	delayStarts    bool
-	msgBus         *nats.Conn
-	subNewProvider *nats.Subscription
-	providers      storage.ProviderRepository
-	articles       storage.ArticleRepository
+	// initialJobs are started by Start, after which all jobs are held by the registry
+	initialJobs []*Job
+	jobs        *jobRegistry
+	delayStarts bool
+	msgBus      events.Bus
+	subs        map[string]events.Subscription
+	providers   storage.ProviderRepository
+	articles    storage.ArticleRepository
+	// ownership is set when providers are shared between aggregator instances
+	ownership *ownership
+	// retention is set when expired articles are removed
+	retention *retention
 }
 
 // NewAggregator returns a new instance of Aggregator, which is used for aggregating news providers that implement `aggregator.NewProvider`
-func NewAggregator(jobs []Job, delayStarts bool, msgBus *nats.Conn, providerRepo storage.ProviderRepository, articles storage.ArticleRepository) (Aggregator, error) {
-	return Aggregator{
-		jobs:        jobs,
+func NewAggregator(jobs []*Job, delayStarts bool, msgBus events.Bus, providerRepo storage.ProviderRepository, articles storage.ArticleRepository) (*Aggregator, error) {
+	registry := newJobRegistry()
+	registry.msgBus = msgBus
+	return &Aggregator{
+		initialJobs: jobs,
+		jobs:        registry,
 		delayStarts: delayStarts,
 		msgBus:      msgBus,
+		subs:        map[string]events.Subscription{},
 		providers:   providerRepo,
 		articles:    articles,
 	}, nil
@@ -41,29 +48,44 @@ func NewAggregator(jobs []Job, delayStarts bool, msgBus *nats.Conn, providerRepo
 func (a *Aggregator) Start() error {
 	log.Print("Starting Aggregator")
 
-	// Subscribe to event bus for new providers
-	sub, err := a.msgBus.Subscribe(events.NewProvider, a.handleNewProvider)
-	if err != nil {
-		return errors.Wrap(err, "msgBus subscribe")
+	// Subscribe to event bus for provider lifecycle changes
+	handlers := map[string]events.Handler{
+		events.NewProvider:     a.handleNewProvider,
+		events.ProviderUpdated: a.handleProviderUpdated,
+		events.ProviderDeleted: a.handleProviderDeleted,
+	}
+	for subject, handler := range handlers {
+		sub, err := a.msgBus.Subscribe(subject, handler)
+		if err != nil {
+			return errors.Wrapf(err, "msgBus subscribe `%s`", subject)
+		}
+		a.subs[subject] = sub
+	}
+
+	if a.retention != nil {
+		a.runRetention()
+	}
+
+	if a.ownership != nil {
+		// Jobs are started as leases for providers are acquired
+		log.Printf("Sharing providers with other aggregator instances as `%s`", a.ownership.instanceID)
+		a.initialJobs = nil
+		a.runOwnership()
+		return nil
 	}
-	a.subNewProvider = sub
 
 	// Start the jobs
-	for i := range a.jobs {
-		job := a.jobs[i]
+	for _, job := range a.initialJobs {
 		if delay := a.delay(); delay > 0 {
 			log.Printf("Starting job `%s` in %s", job.Label, delay)
-			time.Sleep(delay)
+			job.startDelay = delay
+		}
+		err := a.jobs.start(job)
+		if err != nil {
+			log.Printf("ERROR: Start job `%s` - %s", job.Label, err.Error())
 		}
-
-		// Lazy way of starting a goroutine
-		go func() {
-			err := job.Start()
-			if err != nil {
-				log.Printf("ERROR: Starting job `%s`. Error=%s", job.Label, err.Error())
-			}
-		}()
 	}
+	a.initialJobs = nil
 	return nil
 }
 
@@ -72,15 +94,64 @@ func (a *Aggregator) Stop() {
 	log.Print("Aggregator stopping")
 
 	// Unsubscribe from queue
-	err := a.subNewProvider.Unsubscribe()
-	if err != nil {
-		log.Printf("ERROR: Unable to subscribe from queue `%s` - %s", events.NewProvider, err.Error())
-		// don't return, continue stopping the jobs.
+	for subject, sub := range a.subs {
+		err := sub.Unsubscribe()
+		if err != nil {
+			log.Printf("ERROR: Unable to unsubscribe from queue `%s` - %s", subject, err.Error())
+			// don't return, continue stopping the jobs.
+		}
+	}
+
+	if a.retention != nil {
+		a.stopRetention()
 	}
 
 	// Stop jobs
-	for _, j := range a.jobs {
-		j.Stop()
+	if a.ownership != nil {
+		a.stopOwnership()
+		return
+	}
+	a.jobs.stopAll()
+}
+
+// UseScheduler makes every job fetch through `scheduler`, limiting concurrency and the rate feeds are fetched from each
+// host. It must be called before Start.
+func (a *Aggregator) UseScheduler(scheduler *Scheduler) {
+	a.jobs.scheduler = scheduler
+}
+
+// JobStatuses returns the status of every running job, ordered by label
+func (a *Aggregator) JobStatuses() []JobStatus {
+	jobs := a.jobs.list()
+	result := make([]JobStatus, 0, len(jobs))
+	for _, job := range jobs {
+		result = append(result, job.Status())
+	}
+	return result
+}
+
+// JobStatus returns the status of the job for the provider related to `providerID`
+func (a *Aggregator) JobStatus(providerID string) (JobStatus, error) {
+	job, exists := a.jobs.get(providerID)
+	if !exists {
+		return JobStatus{}, errNoJob(providerID)
+	}
+	return job.Status(), nil
+}
+
+// TriggerPoll makes the job for the provider related to `providerID` poll immediately
+func (a *Aggregator) TriggerPoll(providerID string) error {
+	job, exists := a.jobs.get(providerID)
+	if !exists {
+		return errNoJob(providerID)
+	}
+	job.TriggerPoll()
+	return nil
+}
+
+func errNoJob(providerID string) error {
+	return storage.ErrNotFound{
+		Message: fmt.Sprintf("No job running for provider `%s`", providerID),
 	}
 }
 
@@ -92,39 +163,112 @@ func (a *Aggregator) delay() time.Duration {
 	return 0
 }
 
-func (a *Aggregator) handleNewProvider(m *nats.Msg) {
-	providerID := string(m.Data)
+func (a *Aggregator) handleNewProvider(msg []byte) {
+	providerID := string(msg)
 	log.Printf("New provider discovered with id `%s`", providerID)
 
-	provider, err := a.providers.GetProvider(context.Background(), providerID)
+	// The message may be a duplicate
+	if _, exists := a.jobs.get(providerID); exists {
+		log.Printf("Skipping new provider `%s` - job already running", providerID)
+		return
+	}
+
+	// Every instance receives the message, only the one that gets the lease runs the job
+	held, err := a.acquireProvider(context.Background(), providerID)
 	if err != nil {
-		switch err := errors.Cause(err).(type) {
-		case storage.ErrNotFound:
-			fmt.Printf("ERROR: Unable to find the specified provider - %s", err.Error())
-		default:
-			fmt.Printf("ERROR: Get provider error - %s", err.Error())
-		}
+		log.Printf("ERROR: Acquire lease for new provider - %s", err.Error())
+		return
+	}
+	if !held {
+		log.Printf("Skipping new provider `%s` - owned by another instance", providerID)
 		return
 	}
 
-	// Build a new instance of provider based on newly received configuration
-	pollingFrequency := time.Duration(time.Second * time.Duration(provider.PollFrequencySeconds))
-	rssp, err := rssprovider.NewRSSProvider(provider.Label, provider.FeedURL, pollingFrequency)
+	job, err := a.buildJob(providerID)
 	if err != nil {
-		fmt.Printf("ERROR: New RSS Provider - %s", err.Error())
+		log.Printf("ERROR: Build job for new provider - %s", err.Error())
+		a.releaseProvider(context.Background(), providerID)
 		return
 	}
-	job, err := NewJob(provider.Label, rssp, a.articles)
+	err = a.jobs.start(job)
 	if err != nil {
-		fmt.Printf("ERROR: Create new job - %s", err.Error())
+		log.Printf("ERROR: Start job for new provider - %s", err.Error())
+	}
+}
+
+func (a *Aggregator) handleProviderUpdated(msg []byte) {
+	providerID := string(msg)
+	log.Printf("Provider updated with id `%s`", providerID)
+
+	if _, exists := a.jobs.get(providerID); !exists && a.ownership != nil {
+		// The provider is run by another instance
 		return
 	}
 
-	// Lazy way to start a goroutine
-	go func() {
-		err := job.Start()
-		if err != nil {
-			log.Printf("ERROR: Starting job `%s`. Error=%s", job.Label, err.Error())
-		}
-	}()
+	job, err := a.buildJob(providerID)
+	if err != nil {
+		log.Printf("ERROR: Build job for updated provider - %s", err.Error())
+		// The existing job's configuration is out of date, so don't leave it running
+		a.jobs.stop(providerID)
+		a.releaseProvider(context.Background(), providerID)
+		return
+	}
+	// The provider may have been taken by another instance while the job was built
+	held, err := a.acquireProvider(context.Background(), providerID)
+	if err != nil {
+		log.Printf("ERROR: Acquire lease for updated provider - %s", err.Error())
+		return
+	}
+	if !held {
+		log.Printf("Lost lease for updated provider `%s` to another instance", providerID)
+		a.jobs.stop(providerID)
+		return
+	}
+
+	// Replace the job, so it picks up the new configuration
+	if a.jobs.replace(job) {
+		return
+	}
+	if a.ownership != nil {
+		// The job was handed back while the new one was built, so the lease isn't ours to keep
+		a.releaseProvider(context.Background(), providerID)
+		return
+	}
+	err = a.jobs.start(job)
+	if err != nil {
+		log.Printf("ERROR: Start job for updated provider - %s", err.Error())
+	}
+}
+
+func (a *Aggregator) handleProviderDeleted(msg []byte) {
+	providerID := string(msg)
+	log.Printf("Provider deleted with id `%s`", providerID)
+
+	if !a.jobs.stop(providerID) {
+		log.Printf("No job running for deleted provider `%s`", providerID)
+		return
+	}
+	a.releaseProvider(context.Background(), providerID)
+}
+
+// buildJob builds a job from the current configuration of the provider related to `providerID`
+func (a *Aggregator) buildJob(providerID string) (*Job, error) {
+	provider, err := a.providers.GetProvider(context.Background(), providerID)
+	if err != nil {
+		return nil, errors.Wrap(err, "get provider")
+	}
+	return a.newJob(provider)
+}
+
+// newJob builds a job for `provider`
+func (a *Aggregator) newJob(provider storage.Provider) (*Job, error) {
+	newsProvider, err := NewProvider(provider)
+	if err != nil {
+		return nil, errors.Wrap(err, "new provider")
+	}
+	job, err := NewJob(provider, newsProvider, a.articles, a.providers)
+	if err != nil {
+		return nil, errors.Wrap(err, "create new job")
+	}
+	return job, nil
 }
@@ -0,0 +1,298 @@
+// Package archive keeps articles removed by the retention policy in gzip compressed JSON lines files, where they can
+// still be read
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+const (
+	// fileExt is the extension of archive files. Files are written with a temporary extension, then renamed, so
+	// readers never see a partly written file.
+	fileExt = ".jsonl.gz"
+	tempExt = ".tmp"
+	// monthFormat names the directory of the month articles were published in
+	monthFormat = "2006-01"
+	// undated holds articles without a published time
+	undated = "undated"
+)
+
+// Archive is a directory of archived articles. Each provider has a directory, holding a directory for each month
+// articles were published in. Every write adds a file to the month, so files are never modified once written.
+type Archive struct {
+	dir string
+}
+
+// New returns the Archive in `dir`, creating the directory if it doesn't exist
+func New(dir string) (*Archive, error) {
+	if dir == "" {
+		return nil, errors.New("archive directory is required")
+	}
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, errors.Wrap(err, "create archive directory")
+	}
+	return &Archive{
+		dir: dir,
+	}, nil
+}
+
+// Write adds `articles` to the archive. They're safely on disk once it returns, so they can be deleted from storage.
+func (a *Archive) Write(articles []storage.Article) error {
+	groups := map[string][]storage.Article{}
+	for _, art := range articles {
+		dir := filepath.Join(a.dir, providerDir(art.ProviderID), month(art))
+		groups[dir] = append(groups[dir], art)
+	}
+	for dir, group := range groups {
+		err := writeFile(dir, group)
+		if err != nil {
+			return errors.Wrapf(err, "write archive file in `%s`", dir)
+		}
+	}
+	return nil
+}
+
+func writeFile(dir string, articles []storage.Article) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return errors.Wrap(err, "create directory")
+	}
+	f, err := ioutil.TempFile(dir, "*"+fileExt+tempExt)
+	if err != nil {
+		return errors.Wrap(err, "create file")
+	}
+	defer os.Remove(f.Name()) // Fails harmlessly once the file is renamed
+	defer f.Close()
+
+	zw := gzip.NewWriter(f)
+	enc := json.NewEncoder(zw)
+	for _, art := range articles {
+		err = enc.Encode(art)
+		if err != nil {
+			return errors.Wrapf(err, "encode article `%s`", art.ID)
+		}
+	}
+	err = zw.Close()
+	if err != nil {
+		return errors.Wrap(err, "compress")
+	}
+	err = f.Sync()
+	if err != nil {
+		return errors.Wrap(err, "sync")
+	}
+	err = f.Close()
+	if err != nil {
+		return errors.Wrap(err, "close")
+	}
+	return os.Rename(f.Name(), strings.TrimSuffix(f.Name(), tempExt))
+}
+
+// GetArticles returns a page of archived articles, newest first. The query's filters, offset and cursor are used the
+// same as for stored articles, but other orders and field selection aren't supported. Every file that may hold
+// matching articles is read, so queries should be limited to a date range where possible.
+func (a *Archive) GetArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error) {
+	err := query.Validate()
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+	if query.SortField() != storage.SortPublished || !query.Descending() {
+		return storage.ArticlePage{}, storage.ErrInvalidQuery{Message: "archived articles are only ordered newest first"}
+	}
+	if len(query.Fields) > 0 {
+		return storage.ArticlePage{}, storage.ErrInvalidQuery{Message: "fields can't be selected from archived articles"}
+	}
+
+	var matches []storage.Article
+	err = a.read(ctx, query, func(art storage.Article) {
+		if selected(art, query) {
+			matches = append(matches, art)
+		}
+	})
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return newer(matches[i], matches[j])
+	})
+
+	skip := query.Offset * query.Count
+	if query.Cursor != "" {
+		cursor, err := storage.DecodeCursor(query)
+		if err != nil {
+			return storage.ArticlePage{}, err
+		}
+		after := storage.Article{ID: cursor.ID, Published: cursor.Time}
+		skip = sort.Search(len(matches), func(i int) bool {
+			return newer(after, matches[i])
+		})
+	}
+	if skip > len(matches) {
+		skip = len(matches)
+	}
+	results := matches[skip:]
+	if limit := query.Limit(); limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return storage.NewArticlePage(results, query), nil
+}
+
+// GetArticle returns the archived article related to `articleID`. `storage.ErrNotFound` is returned if there's no
+// such article. The whole archive may be read to find it.
+func (a *Archive) GetArticle(ctx context.Context, articleID string) (storage.Article, error) {
+	var result *storage.Article
+	err := a.read(ctx, storage.ArticleQuery{}, func(art storage.Article) {
+		if art.ID == articleID && result == nil {
+			result = &art
+		}
+	})
+	if err != nil {
+		return storage.Article{}, err
+	}
+	if result == nil {
+		return storage.Article{}, storage.ErrNotFound{
+			Message: fmt.Sprintf("No archived article found for ID `%s`", articleID),
+		}
+	}
+	return *result, nil
+}
+
+// read calls `fn` with each article in the files that may hold articles published in the query's date range. Articles
+// that were archived more than once, because deleting them from storage failed, are only read once.
+func (a *Archive) read(ctx context.Context, query storage.ArticleQuery, fn func(art storage.Article)) error {
+	files, err := filepath.Glob(filepath.Join(a.dir, "*", "*", "*"+fileExt))
+	if err != nil {
+		return errors.Wrap(err, "list archive files")
+	}
+	seen := map[string]bool{}
+	for _, file := range files {
+		if !inRange(filepath.Base(filepath.Dir(file)), query) {
+			continue
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err = readFile(file, func(art storage.Article) {
+			if !seen[art.ID] {
+				seen[art.ID] = true
+				fn(art)
+			}
+		})
+		if err != nil {
+			return errors.Wrapf(err, "read archive file `%s`", file)
+		}
+	}
+	return nil
+}
+
+func readFile(file string, fn func(art storage.Article)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return errors.Wrap(err, "decompress")
+	}
+	defer zr.Close()
+
+	dec := json.NewDecoder(zr)
+	for dec.More() {
+		var art storage.Article
+		err = dec.Decode(&art)
+		if err != nil {
+			return errors.Wrap(err, "decode article")
+		}
+		fn(art)
+	}
+	return nil
+}
+
+// providerDir returns the directory name for the provider related to `providerID`, which is safe to use in a path
+func providerDir(providerID string) string {
+	if providerID == "" {
+		return "unknown"
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, providerID)
+}
+
+// month returns the name of the directory for the month `art` was published in
+func month(art storage.Article) string {
+	if art.Published.IsZero() {
+		return undated
+	}
+	return art.Published.UTC().Format(monthFormat)
+}
+
+// inRange reports whether the month directory `name` may hold articles published in the query's date range
+func inRange(name string, query storage.ArticleQuery) bool {
+	if name == undated {
+		return query.Since.IsZero()
+	}
+	start, err := time.Parse(monthFormat, name)
+	if err != nil {
+		return false
+	}
+	if !query.Since.IsZero() && !start.AddDate(0, 1, 0).After(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !start.Before(query.Until) {
+		return false
+	}
+	return true
+}
+
+// selected reports whether `art` is selected by the query's filters
+func selected(art storage.Article, query storage.ArticleQuery) bool {
+	if len(query.Categories) > 0 && !containsAny(art.Categories, query.Categories) {
+		return false
+	}
+	if len(query.Providers) > 0 && !containsAny([]string{art.Provider}, query.Providers) {
+		return false
+	}
+	if !query.Since.IsZero() && art.Published.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && !art.Published.Before(query.Until) {
+		return false
+	}
+	return true
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newer reports whether `a` comes before `b` in the archive's order, newest first then by ID
+func newer(a, b storage.Article) bool {
+	if !a.Published.Equal(b.Published) {
+		return a.Published.After(b.Published)
+	}
+	return a.ID > b.ID
+}
@@ -0,0 +1,205 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+// epoch is the published time of the oldest test article
+var epoch = time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// newArticle returns a test article from `providerID`, published `n` days after epoch
+func newArticle(providerID, guid string, n int) storage.Article {
+	return storage.Article{
+		ID:          storage.ArticleID(providerID, guid),
+		ProviderID:  providerID,
+		GUID:        guid,
+		Title:       "Article " + guid,
+		Link:        "https://example.com/" + guid,
+		Description: "Description of " + guid,
+		Content:     "<p>Content</p>",
+		Published:   epoch.AddDate(0, 0, n),
+		Ingested:    epoch.AddDate(0, 0, n).Add(time.Minute),
+		Categories:  []string{"news"},
+		Provider:    "Example",
+	}
+}
+
+func newArchive(t *testing.T) *Archive {
+	t.Helper()
+	a, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return a
+}
+
+func write(t *testing.T, a *Archive, articles ...storage.Article) {
+	t.Helper()
+	err := a.Write(articles)
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+}
+
+func ids(articles []storage.Article) []string {
+	result := []string{}
+	for _, art := range articles {
+		result = append(result, art.ID)
+	}
+	return result
+}
+
+func TestRoundTrip(t *testing.T) {
+	a := newArchive(t)
+	other := newArticle("provider/../2", "guid", 40)
+	other.Provider = "Other"
+	undatedArticle := newArticle("1", "undated", 0)
+	undatedArticle.Published = time.Time{}
+	articles := []storage.Article{newArticle("1", "a", 0), newArticle("1", "b", 35), other, undatedArticle}
+	write(t, a, articles...)
+
+	files, err := filepath.Glob(filepath.Join(a.dir, "*", "*", "*"+fileExt))
+	if err != nil {
+		t.Fatalf("Glob() error = %v", err)
+	}
+	if len(files) != 4 {
+		t.Errorf("got %d archive files, want one for each provider and month: %v", len(files), files)
+	}
+
+	for _, want := range articles {
+		got, err := a.GetArticle(context.Background(), want.ID)
+		if err != nil {
+			t.Fatalf("GetArticle(%q) error = %v", want.ID, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("GetArticle(%q) = %+v, want %+v", want.ID, got, want)
+		}
+	}
+
+	_, err = a.GetArticle(context.Background(), "missing")
+	if _, ok := err.(storage.ErrNotFound); !ok {
+		t.Errorf("GetArticle() of a missing article error = %v, want storage.ErrNotFound", err)
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	a := newArchive(t)
+	first := newArticle("1", "a", 0)
+	write(t, a, first, newArticle("1", "b", 1))
+	// Articles are archived again if deleting them from storage failed after they were first archived
+	again := first
+	again.Title = "Archived again"
+	write(t, a, again)
+
+	page, err := a.GetArticles(context.Background(), storage.ArticleQuery{Count: 10})
+	if err != nil {
+		t.Fatalf("GetArticles() error = %v", err)
+	}
+	got := ids(page.Articles)
+	want := []string{newArticle("1", "b", 1).ID, first.ID}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetArticles() = %v, want %v", got, want)
+	}
+}
+
+func TestGetArticles(t *testing.T) {
+	a := newArchive(t)
+	var articles []storage.Article
+	for i := 0; i < 6; i++ {
+		art := newArticle("1", fmt.Sprintf("guid-%d", i), i*10)
+		if i%2 == 1 {
+			art.Categories = []string{"sport"}
+			art.Provider = "Other"
+		}
+		articles = append(articles, art)
+	}
+	write(t, a, articles...)
+	newestFirst := func(indexes ...int) []string {
+		var result []string
+		for _, i := range indexes {
+			result = append(result, articles[i].ID)
+		}
+		return result
+	}
+
+	tests := []struct {
+		name  string
+		query storage.ArticleQuery
+		want  []string
+	}{
+		{"all", storage.ArticleQuery{Count: 10}, newestFirst(5, 4, 3, 2, 1, 0)},
+		{"first page", storage.ArticleQuery{Count: 2}, newestFirst(5, 4)},
+		{"offset", storage.ArticleQuery{Count: 2, Offset: 1}, newestFirst(3, 2)},
+		{"offset past the end", storage.ArticleQuery{Count: 2, Offset: 5}, nil},
+		{"category", storage.ArticleQuery{Count: 10, Categories: []string{"sport"}}, newestFirst(5, 3, 1)},
+		{"provider", storage.ArticleQuery{Count: 10, Providers: []string{"Example"}}, newestFirst(4, 2, 0)},
+		{"date range", storage.ArticleQuery{Count: 10, Since: epoch.AddDate(0, 0, 10), Until: epoch.AddDate(0, 0, 30)}, newestFirst(2, 1)},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			page, err := a.GetArticles(context.Background(), tc.query)
+			if err != nil {
+				t.Fatalf("GetArticles() error = %v", err)
+			}
+			got := ids(page.Articles)
+			if len(got) == 0 && len(tc.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GetArticles() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+
+	t.Run("cursor", func(t *testing.T) {
+		var got []string
+		pages := 0
+		// The last page is full, but there's no page after it
+		query := storage.ArticleQuery{Count: 3}
+		for {
+			page, err := a.GetArticles(context.Background(), query)
+			if err != nil {
+				t.Fatalf("GetArticles() error = %v", err)
+			}
+			pages++
+			got = append(got, ids(page.Articles)...)
+			if page.NextCursor == "" {
+				break
+			}
+			query.Cursor = page.NextCursor
+		}
+		want := newestFirst(5, 4, 3, 2, 1, 0)
+		if !reflect.DeepEqual(got, want) || pages != 2 {
+			t.Errorf("%d pages = %v, want 2 pages = %v", pages, got, want)
+		}
+	})
+}
+
+func TestGetArticlesUnsupported(t *testing.T) {
+	a := newArchive(t)
+	tests := []struct {
+		name  string
+		query storage.ArticleQuery
+	}{
+		{"oldest first", storage.ArticleQuery{Count: 10, Order: storage.OrderAscending}},
+		{"by title", storage.ArticleQuery{Count: 10, Sort: storage.SortTitle}},
+		{"fields", storage.ArticleQuery{Count: 10, Fields: []string{"title"}}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := a.GetArticles(context.Background(), tc.query)
+			if _, ok := err.(storage.ErrInvalidQuery); !ok {
+				t.Errorf("GetArticles() error = %v, want storage.ErrInvalidQuery", err)
+			}
+		})
+	}
+}
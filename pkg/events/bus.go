@@ -0,0 +1,16 @@
+package events
+
+// Handler handles a message published on a subject
+type Handler func(msg []byte)
+
+// Subscription is held by a subscriber until it stops receiving messages
+type Subscription interface {
+	Unsubscribe() error
+}
+
+// Bus defines functionality to publish and subscribe to messages. Handlers are called asynchronously, in the order
+// messages were published.
+type Bus interface {
+	Publish(subject string, msg []byte) error
+	Subscribe(subject string, handler Handler) (Subscription, error)
+}
@@ -1,8 +1,21 @@
 package events
 
 const (
-	// NewNewsItem sent when a new news article is picked up
+	// NewNewsItem sent when a new news article is picked up. The message is an `Articles` JSON document.
 	NewNewsItem = "new-news-item"
+	// ArticleUpdated is sent when a stored news article has changed. The message is an `Articles` JSON document.
+	ArticleUpdated = "article-updated"
 	// NewProvider is sent when a new provider has been received and persisted
 	NewProvider = "new-provider"
+	// ProviderUpdated is sent when the configuration of an existing provider has been changed
+	ProviderUpdated = "provider-updated"
+	// ProviderDeleted is sent when a provider has been deleted
+	ProviderDeleted = "provider-deleted"
 )
+
+// Articles is the message sent with article events
+type Articles struct {
+	ProviderID string   `json:"providerID"`
+	Provider   string   `json:"provider"`
+	ArticleIDs []string `json:"articleIDs"`
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"sync"
+)
+
+// Local is a `Bus` within a process, for running every service in one process without a NATS server. Like NATS,
+// each subscription receives messages on its own goroutine, so a slow handler doesn't hold up the publisher.
+type Local struct {
+	mu   sync.RWMutex
+	subs map[string]map[*localSubscription]bool
+}
+
+// NewLocal returns a Local bus with no subscribers
+func NewLocal() *Local {
+	return &Local{
+		subs: map[string]map[*localSubscription]bool{},
+	}
+}
+
+// Publish queues `msg` for every subscriber to `subject`
+func (l *Local) Publish(subject string, msg []byte) error {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for sub := range l.subs[subject] {
+		// Each subscriber gets its own copy, as NATS subscribers do
+		sub.queue(append([]byte(nil), msg...))
+	}
+	return nil
+}
+
+// Subscribe calls `handler` with each message published on `subject`
+func (l *Local) Subscribe(subject string, handler Handler) (Subscription, error) {
+	sub := &localSubscription{
+		bus:     l,
+		subject: subject,
+		handler: handler,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	l.mu.Lock()
+	if l.subs[subject] == nil {
+		l.subs[subject] = map[*localSubscription]bool{}
+	}
+	l.subs[subject][sub] = true
+	l.mu.Unlock()
+
+	go sub.run()
+	return sub, nil
+}
+
+type localSubscription struct {
+	bus     *Local
+	subject string
+	handler Handler
+
+	mu      sync.Mutex
+	pending [][]byte
+	// wake is signalled when messages are queued
+	wake chan struct{}
+	done chan struct{}
+}
+
+func (s *localSubscription) queue(msg []byte) {
+	s.mu.Lock()
+	s.pending = append(s.pending, msg)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+		// Already signalled
+	}
+}
+
+// run calls the handler with queued messages until unsubscribed
+func (s *localSubscription) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+
+		s.mu.Lock()
+		msgs := s.pending
+		s.pending = nil
+		s.mu.Unlock()
+
+		for _, msg := range msgs {
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.handler(msg)
+		}
+	}
+}
+
+// Unsubscribe stops messages being delivered. Messages that are queued and not yet handled are dropped.
+func (s *localSubscription) Unsubscribe() error {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+
+	if !s.bus.subs[s.subject][s] {
+		return nil
+	}
+	delete(s.bus.subs[s.subject], s)
+	close(s.done)
+	return nil
+}
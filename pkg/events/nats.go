@@ -1,27 +1,43 @@
 package events
 
-// // Nat defines functionality to access the Nats message queue
-// type Nat struct {
-// 	connection *nats.Conn
-// }
+import (
+	"github.com/nats-io/nats.go"
+	"github.com/pkg/errors"
+)
 
-// // MessageBus defines functionality to publish messages on a message bus
-// type MessageBus interface {
-// 	Publish(subject string, msg []byte) error
-// }
+// Nats is a `Bus` using a NATS server, so messages are shared between services
+type Nats struct {
+	connection *nats.Conn
+}
 
-// // New returns a new instance of Nats
-// func New(conn string) (*Nat, error) {
-// 	nc, err := nats.Connect(conn)
-// 	if err != nil {
-// 		return nil, errors.Wrap(err, "nats connect")
-// 	}
-// 	return &Nat{
-// 		connection: nc,
-// 	}, nil
-// }
+// NewNats connects to the NATS server at `conn`
+func NewNats(conn string) (*Nats, error) {
+	nc, err := nats.Connect(conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "nats connect")
+	}
+	return &Nats{
+		connection: nc,
+	}, nil
+}
 
-// // Publish submits a message to the queue using provided subject
-// func (n *Nat) Publish(subject string, msg []byte) error {
-// 	return errors.Wrap(n.connection.Publish(subject, msg), "nats publish")
-// }
+// Publish submits a message to the queue using provided subject
+func (n *Nats) Publish(subject string, msg []byte) error {
+	return errors.Wrap(n.connection.Publish(subject, msg), "nats publish")
+}
+
+// Subscribe calls `handler` with each message published on `subject`
+func (n *Nats) Subscribe(subject string, handler Handler) (Subscription, error) {
+	sub, err := n.connection.Subscribe(subject, func(m *nats.Msg) {
+		handler(m.Data)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "nats subscribe")
+	}
+	return sub, nil
+}
+
+// Close closes the connection to the server
+func (n *Nats) Close() {
+	n.connection.Close()
+}
@@ -7,8 +7,10 @@ import (
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/chackett/zignews/pkg/schedule"
 	"github.com/chackett/zignews/pkg/storage"
 	"github.com/gorilla/mux"
 	"github.com/pkg/errors"
@@ -24,8 +26,14 @@ type Handler struct {
 
 // Service defines the functionality required by the mobile-api
 type Service interface {
-	GetArticles(ctx context.Context, offset, count int, category, provider []string) ([]storage.Article, error)
+	GetArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error)
+	GetArticle(ctx context.Context, articleID string) (storage.Article, error)
+	GetArchivedArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error)
+	GetArchivedArticle(ctx context.Context, articleID string) (storage.Article, error)
+	Search(ctx context.Context, query storage.SearchQuery) ([]storage.Article, error)
 	SaveProvider(ctx context.Context, provider storage.Provider) (string, error)
+	UpdateProvider(ctx context.Context, providerID string, provider storage.Provider) error
+	DeleteProvider(ctx context.Context, providerID string) error
 }
 
 // ErrorResponse is returned to requests that result in some error state such as bad request or internal server error
@@ -48,7 +56,11 @@ func NewHandler(service Service, addr string) (Handler, error) {
 	// r.HandleFunc(fmt.Sprintf("%s/provider", apiPrefixWithVersion), h.HandlePostProvider()).Methods(http.MethodPost)
 	// r.HandleFunc(fmt.Sprintf("%s/ping", apiPrefixWithVersion), h.HandlePing()).Methods(http.MethodGet)
 	r.HandleFunc("/article", h.HandleGetArticles()).Methods(http.MethodGet)
+	r.HandleFunc("/article/{id}", h.HandleGetArticle()).Methods(http.MethodGet)
+	r.HandleFunc("/search", h.HandleSearch()).Methods(http.MethodGet)
 	r.HandleFunc("/provider", h.HandlePostProvider()).Methods(http.MethodPost)
+	r.HandleFunc("/provider/{id}", h.HandlePutProvider()).Methods(http.MethodPut)
+	r.HandleFunc("/provider/{id}", h.HandleDeleteProvider()).Methods(http.MethodDelete)
 	r.HandleFunc("/ping", h.HandlePing()).Methods(http.MethodGet)
 	r.StrictSlash(true) // Saves being a nuisance
 
@@ -99,12 +111,9 @@ func (h *Handler) returnError(err error, statusCode int, w http.ResponseWriter)
 
 // HandleGetArticles returns articles matching specified criteria
 func (h *Handler) HandleGetArticles() http.HandlerFunc {
-	type ArticleResponse struct {
-		Articles []storage.Article `json:"articles,omitempty"`
-	}
-
 	return func(w http.ResponseWriter, r *http.Request) {
-		// Offset and count used to satisfy the "scrollable list" via pagination.
+		// Offset and count used to satisfy the "scrollable list" via pagination. Clients should prefer the cursor, as
+		// offset pages shift when new articles arrive.
 		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
 		if err != nil {
 			log.Print("use default offset value")
@@ -119,16 +128,112 @@ func (h *Handler) HandleGetArticles() http.HandlerFunc {
 
 		// Filters - supports querystring format ?category=politics&category=technology&provider=msn&provider=bbc
 		// These could be further sanitised
-		categories := r.URL.Query()["category"]
-		providers := r.URL.Query()["provider"]
+		// Published date range - supports RFC 3339 times or dates, e.g. ?since=2020-10-01&until=2020-10-08T12:00:00Z
+		since, err := parseTime(r.URL.Query().Get("since"))
+		if err != nil {
+			h.returnError(errors.Wrap(err, "parse since"), http.StatusBadRequest, w)
+			return
+		}
+		until, err := parseTime(r.URL.Query().Get("until"))
+		if err != nil {
+			h.returnError(errors.Wrap(err, "parse until"), http.StatusBadRequest, w)
+			return
+		}
+
+		// Ordering and field selection - supports querystring format ?sort=title&order=asc&fields=title,link
+		var fields []string
+		if f := r.URL.Query().Get("fields"); f != "" {
+			fields = strings.Split(f, ",")
+		}
+
+		query := storage.ArticleQuery{
+			Offset:     offset,
+			Count:      count,
+			Cursor:     r.URL.Query().Get("cursor"),
+			Categories: r.URL.Query()["category"],
+			Providers:  r.URL.Query()["provider"],
+			Since:      since,
+			Until:      until,
+			Sort:       r.URL.Query().Get("sort"),
+			Order:      r.URL.Query().Get("order"),
+			Fields:     fields,
+		}
 
-		articles, err := h.service.GetArticles(r.Context(), offset, count, categories, providers)
+		// Archived articles, which have been removed by the retention policy, are listed instead with ?archived=true
+		getArticles := h.service.GetArticles
+		if archived(r) {
+			getArticles = h.service.GetArchivedArticles
+		}
+		page, err := getArticles(r.Context(), query)
 		if err != nil {
-			h.returnError(errors.Wrap(err, "get articles"), http.StatusInternalServerError, w)
+			h.returnError(errors.Wrap(err, "get articles"), statusCode(err), w)
 			return
 		}
 
-		response := ArticleResponse{
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(page)
+		if err != nil {
+			log.Printf("ERROR: encoding response to client: %s", err.Error())
+		}
+	}
+}
+
+// archived reports whether the request is for archived articles
+func archived(r *http.Request) bool {
+	include, _ := strconv.ParseBool(r.URL.Query().Get("archived"))
+	return include
+}
+
+// parseTime parses an RFC 3339 time or a date. The zero time is returned for an empty string.
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("`%s` is not an RFC 3339 time or a date", value)
+	}
+	return t, nil
+}
+
+// HandleSearch returns articles whose title or description match the `q` parameter. Results are ranked by relevance,
+// or newest first with `rank=recency`, and can be filtered the same as HandleGetArticles.
+func (h *Handler) HandleSearch() http.HandlerFunc {
+	type SearchResponse struct {
+		Articles []storage.Article `json:"articles,omitempty"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil {
+			offset = defaultOffset
+		}
+
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil {
+			count = defaultPageSize
+		}
+
+		query := storage.SearchQuery{
+			Text:       r.URL.Query().Get("q"),
+			Rank:       r.URL.Query().Get("rank"),
+			Offset:     offset,
+			Count:      count,
+			Categories: r.URL.Query()["category"],
+			Providers:  r.URL.Query()["provider"],
+		}
+
+		articles, err := h.service.Search(r.Context(), query)
+		if err != nil {
+			h.returnError(errors.Wrap(err, "search articles"), statusCode(err), w)
+			return
+		}
+
+		response := SearchResponse{
 			Articles: articles,
 		}
 		w.WriteHeader(http.StatusOK)
@@ -139,21 +244,79 @@ func (h *Handler) HandleGetArticles() http.HandlerFunc {
 	}
 }
 
-// HandlePostProvider saves provider information for use by the aggregator component
-func (h *Handler) HandlePostProvider() http.HandlerFunc {
-	type Request struct {
-		Type                 string `json:"type,omitempty"`
-		Label                string `json:"label,omitempty"`
-		FeedURL              string `json:"feedURL,omitempty"`
-		PollFrequencySeconds int    `json:"pollFrequencySeconds,omitempty"`
+// HandleGetArticle returns a single article
+func (h *Handler) HandleGetArticle() http.HandlerFunc {
+	type ArticleResponse struct {
+		Article storage.Article `json:"article"`
 	}
 
+	return func(w http.ResponseWriter, r *http.Request) {
+		articleID := mux.Vars(r)["id"]
+
+		// With ?archived=true the article is also looked for in the archive
+		getArticle := h.service.GetArticle
+		if archived(r) {
+			getArticle = h.service.GetArchivedArticle
+		}
+		article, err := getArticle(r.Context(), articleID)
+		if err != nil {
+			h.returnError(errors.Wrap(err, "get article"), statusCode(err), w)
+			return
+		}
+
+		response := ArticleResponse{
+			Article: article,
+		}
+		w.WriteHeader(http.StatusOK)
+		err = json.NewEncoder(w).Encode(response)
+		if err != nil {
+			log.Printf("ERROR: encoding response to client: %s", err.Error())
+		}
+	}
+}
+
+// providerRequest is the request body used to create or update a provider
+type providerRequest struct {
+	Type                 string `json:"type,omitempty"`
+	Label                string `json:"label,omitempty"`
+	FeedURL              string `json:"feedURL,omitempty"`
+	PollFrequencySeconds int    `json:"pollFrequencySeconds,omitempty"`
+	// Schedule is a cron expression, used instead of PollFrequencySeconds
+	Schedule   string            `json:"schedule,omitempty"`
+	QuietHours []schedule.Window `json:"quietHours,omitempty"`
+	Timezone   string            `json:"timezone,omitempty"`
+	// Adaptive polling learns the poll frequency between the min and max, starting from PollFrequencySeconds
+	Adaptive                bool `json:"adaptive,omitempty"`
+	MinPollFrequencySeconds int  `json:"minPollFrequencySeconds,omitempty"`
+	MaxPollFrequencySeconds int  `json:"maxPollFrequencySeconds,omitempty"`
+	// RetentionDays is how long articles are kept, the global retention policy applies if it's zero
+	RetentionDays int `json:"retentionDays,omitempty"`
+}
+
+func (p providerRequest) provider() storage.Provider {
+	return storage.Provider{
+		Label:                   p.Label,
+		FeedURL:                 p.FeedURL,
+		PollFrequencySeconds:    p.PollFrequencySeconds,
+		Type:                    p.Type,
+		Schedule:                p.Schedule,
+		QuietHours:              p.QuietHours,
+		Timezone:                p.Timezone,
+		Adaptive:                p.Adaptive,
+		MinPollFrequencySeconds: p.MinPollFrequencySeconds,
+		MaxPollFrequencySeconds: p.MaxPollFrequencySeconds,
+		RetentionDays:           p.RetentionDays,
+	}
+}
+
+// HandlePostProvider saves provider information for use by the aggregator component
+func (h *Handler) HandlePostProvider() http.HandlerFunc {
 	type Response struct {
 		InsertedProviderID string `json:"insertedProviderID,omitempty"`
 	}
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		var requestObj Request
+		var requestObj providerRequest
 		defer r.Body.Close()
 		err := json.NewDecoder(r.Body).Decode(&requestObj)
 		if err != nil {
@@ -161,16 +324,11 @@ func (h *Handler) HandlePostProvider() http.HandlerFunc {
 			return
 		}
 
-		provider := storage.Provider{
-			Label:                requestObj.Label,
-			FeedURL:              requestObj.FeedURL,
-			PollFrequencySeconds: requestObj.PollFrequencySeconds,
-			Type:                 requestObj.Type,
-		}
+		provider := requestObj.provider()
 
 		providerID, err := h.service.SaveProvider(r.Context(), provider)
 		if err != nil {
-			h.returnError(errors.Wrap(err, "save provider"), http.StatusInternalServerError, w)
+			h.returnError(errors.Wrap(err, "save provider"), statusCode(err), w)
 			return
 		}
 
@@ -186,6 +344,59 @@ func (h *Handler) HandlePostProvider() http.HandlerFunc {
 	}
 }
 
+// HandlePutProvider replaces the configuration of an existing provider
+func (h *Handler) HandlePutProvider() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providerID := mux.Vars(r)["id"]
+
+		var requestObj providerRequest
+		defer r.Body.Close()
+		err := json.NewDecoder(r.Body).Decode(&requestObj)
+		if err != nil {
+			h.returnError(errors.Wrap(err, "parse request"), http.StatusBadRequest, w)
+			return
+		}
+
+		err = h.service.UpdateProvider(r.Context(), providerID, requestObj.provider())
+		if err != nil {
+			h.returnError(errors.Wrap(err, "update provider"), statusCode(err), w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// HandleDeleteProvider deletes a provider, which stops it being aggregated
+func (h *Handler) HandleDeleteProvider() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		providerID := mux.Vars(r)["id"]
+
+		err := h.service.DeleteProvider(r.Context(), providerID)
+		if err != nil {
+			h.returnError(errors.Wrap(err, "delete provider"), statusCode(err), w)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// statusCode returns the http status to respond with for an error returned by the service
+func statusCode(err error) int {
+	if errors.Cause(err) == storage.ErrInvalidCursor {
+		return http.StatusBadRequest
+	}
+	switch errors.Cause(err).(type) {
+	case storage.ErrNotFound:
+		return http.StatusNotFound
+	case storage.ErrInvalidQuery, storage.ErrInvalidProvider:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 // HandlePing is a simple handle to enable clients to test connectivity
 func (h *Handler) HandlePing() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -2,13 +2,12 @@ package mobileapi
 
 import (
 	"context"
-	"fmt"
 	"log"
-	"net/url"
 
+	"github.com/chackett/zignews/pkg/aggregator"
+	"github.com/chackett/zignews/pkg/archive"
 	"github.com/chackett/zignews/pkg/events"
 	"github.com/chackett/zignews/pkg/storage"
-	"github.com/nats-io/nats.go"
 	"github.com/pkg/errors"
 )
 
@@ -19,25 +18,22 @@ const (
 	defaultPageSize = 20
 	// defaultOffset defines the default offset value if unspecified or unsafe
 	defaultOffset = 0
-	// minPollFrequencyMinutes defines the minimum allowable polling frequency
-	minPollFrequencySeconds = 10 // Useful to prevent possible rate limiting / abuse
-	// maxPollFrequencyMinutes defines the maximum allowable polling frequency
-	maxPollFrequencySeconds = 60 * 60 * 24 // Not really sure we need an upper limit but nice to have configurability
 )
 
-// SupportedProviders contains a list of "type" of providers that are supported by the aggregator.
-// This map could later on use a factory function to create an instance of associated provider, instead of the placeholder `interface{}`
-var SupportedProviders map[string]interface{} = map[string]interface{}{"rss": nil}
+// errNoArchive is returned when archived articles are requested but there's no archive to read them from
+var errNoArchive = storage.ErrInvalidQuery{Message: "archived articles aren't available"}
 
 // ServiceImpl implements the domain logic for the mobile api
 type ServiceImpl struct {
 	articles  storage.ArticleRepository
 	providers storage.ProviderRepository
-	msgBus    *nats.Conn
+	msgBus    events.Bus
+	// archive is set when archived articles can be read
+	archive *archive.Archive
 }
 
 // NewService returns a new instance of the service mobile api service domain logic implementation
-func NewService(articleRepo storage.ArticleRepository, providerRepo storage.ProviderRepository, msgBus *nats.Conn) (*ServiceImpl, error) {
+func NewService(articleRepo storage.ArticleRepository, providerRepo storage.ProviderRepository, msgBus events.Bus) (*ServiceImpl, error) {
 	if articleRepo == nil {
 		return nil, errors.New("article repository is nil")
 	}
@@ -51,40 +47,107 @@ func NewService(articleRepo storage.ArticleRepository, providerRepo storage.Prov
 	}, nil
 }
 
-// GetArticles retrieves a list of articles from underlying storage. Filter parameters can be used to reduce the results
-func (s *ServiceImpl) GetArticles(ctx context.Context, offset, count int, category, provider []string) ([]storage.Article, error) {
-	if count < 0 || count > maxPageSize {
-		count = defaultPageSize
+// UseArchive lets clients read the articles the aggregator has archived to `arch`
+func (s *ServiceImpl) UseArchive(arch *archive.Archive) {
+	s.archive = arch
+}
+
+// GetArticles retrieves a page of articles from underlying storage. Filter parameters can be used to reduce the results
+func (s *ServiceImpl) GetArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error) {
+	if query.Count <= 0 || query.Count > maxPageSize {
+		query.Count = defaultPageSize
+	}
+	if query.Offset < 0 {
+		query.Offset = defaultOffset
+	}
+	err := query.Validate()
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+
+	page, err := s.articles.GetArticles(ctx, query)
+	if err != nil {
+		return storage.ArticlePage{}, errors.Wrap(err, "get articles from repository")
+	}
+
+	return page, nil
+}
+
+// GetArchivedArticles retrieves a page of archived articles, newest first. Filter parameters can be used to reduce the
+// results.
+func (s *ServiceImpl) GetArchivedArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error) {
+	if s.archive == nil {
+		return storage.ArticlePage{}, errNoArchive
+	}
+	if query.Count <= 0 || query.Count > maxPageSize {
+		query.Count = defaultPageSize
+	}
+	if query.Offset < 0 {
+		query.Offset = defaultOffset
 	}
-	if offset < 0 {
-		offset = defaultOffset
+
+	page, err := s.archive.GetArticles(ctx, query)
+	if err != nil {
+		return storage.ArticlePage{}, errors.Wrap(err, "get articles from archive")
+	}
+	return page, nil
+}
+
+// Search retrieves a page of articles matching the search text from underlying storage. Filter parameters can be used
+// to reduce the results
+func (s *ServiceImpl) Search(ctx context.Context, query storage.SearchQuery) ([]storage.Article, error) {
+	if query.Count <= 0 || query.Count > maxPageSize {
+		query.Count = defaultPageSize
+	}
+	if query.Offset < 0 {
+		query.Offset = defaultOffset
+	}
+	if query.Rank == "" {
+		query.Rank = storage.RankRelevance
+	}
+	err := query.Validate()
+	if err != nil {
+		return nil, err
 	}
 
-	articles, err := s.articles.GetArticles(ctx, offset, count, category, provider)
+	articles, err := s.articles.Search(ctx, query)
 	if err != nil {
-		return nil, errors.Wrap(err, "get articles from repository")
+		return nil, errors.Wrap(err, "search articles in repository")
 	}
 
 	return articles, nil
 }
 
-// SaveProvider saves a provider to underlying storage
-func (s *ServiceImpl) SaveProvider(ctx context.Context, provider storage.Provider) (string, error) {
-	if provider.Label == "" {
-		return "", errors.New("provider label is required")
+// GetArticle retrieves a single article from underlying storage
+func (s *ServiceImpl) GetArticle(ctx context.Context, articleID string) (storage.Article, error) {
+	article, err := s.articles.GetArticle(ctx, articleID)
+	if err != nil {
+		return storage.Article{}, errors.Wrap(err, "get article from repository")
+	}
+	return article, nil
+}
+
+// GetArchivedArticle retrieves a single article from underlying storage, or from the archive if it's been archived
+func (s *ServiceImpl) GetArchivedArticle(ctx context.Context, articleID string) (storage.Article, error) {
+	if s.archive == nil {
+		return storage.Article{}, errNoArchive
 	}
-	if _, ok := SupportedProviders[provider.Type]; !ok {
-		return "", fmt.Errorf("`%s` is an unsupported provider type", provider.Type)
+	article, err := s.GetArticle(ctx, articleID)
+	if _, ok := errors.Cause(err).(storage.ErrNotFound); !ok {
+		return article, err
 	}
-	_, err := url.ParseRequestURI(provider.FeedURL)
+	article, err = s.archive.GetArticle(ctx, articleID)
 	if err != nil {
-		return "", errors.New("provider feedURL must be a valid URL")
+		return storage.Article{}, errors.Wrap(err, "get article from archive")
 	}
+	return article, nil
+}
 
-	// If the poll frequency is invalid we don't want to use default and result in unexpected behaviour by the operator.
-	// Better to let them know.
-	if provider.PollFrequencySeconds < minPollFrequencySeconds || provider.PollFrequencySeconds > maxPollFrequencySeconds {
-		return "", fmt.Errorf("Invalid polling frequency, %d seconds. Must be inside range %d-%d", provider.PollFrequencySeconds, minPollFrequencySeconds, maxPollFrequencySeconds)
+// SaveProvider saves a provider to underlying storage
+func (s *ServiceImpl) SaveProvider(ctx context.Context, provider storage.Provider) (string, error) {
+	err := validateProvider(provider)
+	if err != nil {
+		return "", err
 	}
 
 	providerID, err := s.providers.InsertProviders(ctx, []storage.Provider{provider})
@@ -99,3 +162,50 @@ func (s *ServiceImpl) SaveProvider(ctx context.Context, provider storage.Provide
 
 	return providerID[0], nil
 }
+
+// UpdateProvider replaces the configuration of an existing provider. The aggregator restarts the provider's job with
+// the new configuration.
+func (s *ServiceImpl) UpdateProvider(ctx context.Context, providerID string, provider storage.Provider) error {
+	err := validateProvider(provider)
+	if err != nil {
+		return err
+	}
+
+	provider.ID = providerID
+	err = s.providers.UpdateProvider(ctx, provider)
+	if err != nil {
+		return errors.Wrap(err, "update provider in repository")
+	}
+
+	err = s.msgBus.Publish(events.ProviderUpdated, []byte(providerID))
+	if err != nil {
+		log.Printf("ERROR: Publish provider updated message to queue - %s", err.Error())
+	}
+
+	return nil
+}
+
+// DeleteProvider deletes a provider. The aggregator stops the provider's job.
+func (s *ServiceImpl) DeleteProvider(ctx context.Context, providerID string) error {
+	err := s.providers.DeleteProvider(ctx, providerID)
+	if err != nil {
+		return errors.Wrap(err, "delete provider from repository")
+	}
+
+	err = s.msgBus.Publish(events.ProviderDeleted, []byte(providerID))
+	if err != nil {
+		log.Printf("ERROR: Publish provider deleted message to queue - %s", err.Error())
+	}
+
+	return nil
+}
+
+func validateProvider(provider storage.Provider) error {
+	// Validation is shared with the aggregator, so the same limits apply to providers however they are stored. Type
+	// specific validation is owned by the factory the aggregator will use to build the provider.
+	err := aggregator.ValidateProvider(provider)
+	if err != nil {
+		return storage.ErrInvalidProvider{Message: err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package rssprovider
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/mmcdole/gofeed/atom"
+	"github.com/pkg/errors"
+)
+
+// AtomProvider provides functionality for retrieving Atom feeds
+type AtomProvider struct {
+	Label         string
+	FeedURL       string
+	PollFrequency time.Duration
+	conditional
+}
+
+// NewAtomProvider returns a new instance of AtomProvider
+func NewAtomProvider(label, feedURL string, pollFrequency time.Duration) (*AtomProvider, error) {
+	if label == "" {
+		return nil, errors.New("label is required")
+	}
+	if _, err := url.ParseRequestURI(feedURL); err != nil {
+		return nil, errors.Wrap(err, "validate feed URL")
+	}
+
+	result := &AtomProvider{
+		Label:         label,
+		FeedURL:       feedURL,
+		PollFrequency: pollFrequency,
+	}
+
+	return result, nil
+}
+
+// Latest returns the latest entries in the feed
+func (ap *AtomProvider) Latest(ctx context.Context) ([]storage.Article, error) {
+	body, state, err := fetch(ctx, ap.FeedURL, ap.state)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch atom feed")
+	}
+	defer body.Close()
+
+	fp := &atom.Parser{}
+	feed, err := fp.Parse(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "atom parse")
+	}
+	ap.state = state
+
+	var result []storage.Article
+	for _, entry := range feed.Entries {
+		// Nullable values checked
+		var published, updated time.Time
+		if entry.UpdatedParsed != nil {
+			updated = *entry.UpdatedParsed
+		}
+		if entry.PublishedParsed != nil {
+			published = *entry.PublishedParsed
+		} else {
+			// `published` is optional in Atom whereas `updated` is mandatory
+			published = updated
+		}
+		var content string
+		if entry.Content != nil {
+			content = entry.Content.Value
+		}
+
+		// Entries inherit the feed authors when they don't declare their own
+		authors := entry.Authors
+		if len(authors) == 0 {
+			authors = feed.Authors
+		}
+
+		a := storage.Article{
+			Title:       entry.Title,
+			Categories:  atomCategories(entry.Categories),
+			Description: entry.Summary,
+			Content:     content,
+			Author:      atomAuthors(authors),
+			GUID:        entry.ID,
+			Link:        atomLink(entry.Links, "alternate"),
+			Published:   published,
+			Updated:     updated,
+			Thumbnail:   atomImage(entry.Links),
+			Provider:    ap.Label,
+		}
+		result = append(result, a)
+	}
+
+	return result, nil
+}
+
+// PollingFrequency returns the amount of time to wait between calls to `Latest()`
+func (ap *AtomProvider) PollingFrequency() time.Duration {
+	return ap.PollFrequency
+}
+
+// atomLink returns the href of the first link with relation `rel`. A link without a `rel` attribute is an alternate link.
+func atomLink(links []*atom.Link, rel string) string {
+	for _, l := range links {
+		if l.Rel == rel || (l.Rel == "" && rel == "alternate") {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// atomImage returns the first image enclosure, Atom has no dedicated element for a thumbnail
+func atomImage(links []*atom.Link) string {
+	for _, l := range links {
+		if l.Rel == "enclosure" && strings.HasPrefix(l.Type, "image/") {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func atomAuthors(people []*atom.Person) string {
+	var names []string
+	for _, p := range people {
+		if p.Name != "" {
+			names = append(names, p.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func atomCategories(categories []*atom.Category) []string {
+	var result []string
+	for _, c := range categories {
+		// The label is the human readable form, the term is always present
+		if c.Label != "" {
+			result = append(result, c.Label)
+			continue
+		}
+		result = append(result, c.Term)
+	}
+	return result
+}
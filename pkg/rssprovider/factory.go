@@ -0,0 +1,67 @@
+package rssprovider
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/chackett/zignews/pkg/aggregator"
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// Provider types implemented by this package
+const (
+	TypeRSS      = "rss"
+	TypeAtom     = "atom"
+	TypeJSONFeed = "jsonfeed"
+)
+
+func init() {
+	aggregator.RegisterProvider(TypeRSS, factory{
+		build: func(label, feedURL string, pollFrequency time.Duration) (statefulProvider, error) {
+			return NewRSSProvider(label, feedURL, pollFrequency)
+		},
+	})
+	aggregator.RegisterProvider(TypeAtom, factory{
+		build: func(label, feedURL string, pollFrequency time.Duration) (statefulProvider, error) {
+			return NewAtomProvider(label, feedURL, pollFrequency)
+		},
+	})
+	aggregator.RegisterProvider(TypeJSONFeed, factory{
+		build: func(label, feedURL string, pollFrequency time.Duration) (statefulProvider, error) {
+			return NewJSONFeedProvider(label, feedURL, pollFrequency)
+		},
+	})
+}
+
+// statefulProvider is implemented by all of the feed providers in this package
+type statefulProvider interface {
+	aggregator.NewsProvider
+	aggregator.StatefulProvider
+}
+
+// factory implements `aggregator.ProviderFactory` for the feed providers, which all share the same configuration
+type factory struct {
+	build func(label, feedURL string, pollFrequency time.Duration) (statefulProvider, error)
+}
+
+// Validate checks the provider has the configuration required by a feed provider. The label and schedule are validated
+// by `storage.Provider.Validate()`.
+func (f factory) Validate(provider storage.Provider) error {
+	if _, err := url.ParseRequestURI(provider.FeedURL); err != nil {
+		return errors.New("provider feedURL must be a valid URL")
+	}
+	return nil
+}
+
+// New returns a new feed provider based on the provider configuration
+func (f factory) New(provider storage.Provider) (aggregator.NewsProvider, error) {
+	pollingFrequency := time.Duration(time.Second * time.Duration(provider.PollFrequencySeconds))
+	p, err := f.build(provider.Label, provider.FeedURL, pollingFrequency)
+	if err != nil {
+		return nil, err
+	}
+	// Resume conditional fetching from where the previous job for this provider left off
+	p.SetFetchState(provider.FetchState)
+	return p, nil
+}
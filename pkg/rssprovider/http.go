@@ -0,0 +1,70 @@
+package rssprovider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/chackett/zignews/pkg/aggregator"
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// httpClient is shared by the feed providers so connections to the same host are reused between polls
+var httpClient = &http.Client{
+	Timeout: 30 * time.Second,
+}
+
+// fetch retrieves the feed at `feedURL`. The cache validators in `state` are used to make a conditional request, and
+// `aggregator.ErrNotModified` is returned if the feed is unchanged. Otherwise the caller is responsible for closing
+// the returned body, and should keep the returned state for the next request.
+func fetch(ctx context.Context, feedURL string, state storage.FetchState) (io.ReadCloser, storage.FetchState, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, feedURL, nil)
+	if err != nil {
+		return nil, state, errors.Wrap(err, "build request")
+	}
+	req.Header.Set("User-Agent", aggregator.UserAgent)
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, state, errors.Wrap(err, "http get")
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, state, aggregator.ErrNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, state, fmt.Errorf("unexpected http status %d", resp.StatusCode)
+	}
+
+	// Validators are replaced rather than merged, a server that stops sending one no longer honours it.
+	newState := state
+	newState.ETag = resp.Header.Get("ETag")
+	newState.LastModified = resp.Header.Get("Last-Modified")
+
+	return resp.Body, newState, nil
+}
+
+// conditional keeps the fetch state of a feed provider between polls. It implements `aggregator.StatefulProvider`.
+type conditional struct {
+	state storage.FetchState
+}
+
+// FetchState returns the state from the last successful fetch
+func (c *conditional) FetchState() storage.FetchState {
+	return c.state
+}
+
+// SetFetchState replaces the state used for the next fetch
+func (c *conditional) SetFetchState(state storage.FetchState) {
+	c.state = state
+}
@@ -0,0 +1,112 @@
+package rssprovider
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/mmcdole/gofeed/json"
+	"github.com/pkg/errors"
+)
+
+// JSONFeedProvider provides functionality for retrieving JSON Feeds (https://jsonfeed.org)
+type JSONFeedProvider struct {
+	Label         string
+	FeedURL       string
+	PollFrequency time.Duration
+	conditional
+}
+
+// NewJSONFeedProvider returns a new instance of JSONFeedProvider
+func NewJSONFeedProvider(label, feedURL string, pollFrequency time.Duration) (*JSONFeedProvider, error) {
+	if label == "" {
+		return nil, errors.New("label is required")
+	}
+	if _, err := url.ParseRequestURI(feedURL); err != nil {
+		return nil, errors.Wrap(err, "validate feed URL")
+	}
+
+	result := &JSONFeedProvider{
+		Label:         label,
+		FeedURL:       feedURL,
+		PollFrequency: pollFrequency,
+	}
+
+	return result, nil
+}
+
+// Latest returns the latest items in the feed
+func (j *JSONFeedProvider) Latest(ctx context.Context) ([]storage.Article, error) {
+	body, state, err := fetch(ctx, j.FeedURL, j.state)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch json feed")
+	}
+	defer body.Close()
+
+	fp := &json.Parser{}
+	feed, err := fp.Parse(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "json feed parse")
+	}
+	j.state = state
+
+	var result []storage.Article
+	for _, item := range feed.Items {
+		// Dates are optional RFC 3339 strings, unparseable values are left as zero.
+		published, _ := time.Parse(time.RFC3339, item.DatePublished)
+		updated, _ := time.Parse(time.RFC3339, item.DateModified)
+
+		content := item.ContentHTML
+		if content == "" {
+			content = item.ContentText
+		}
+
+		// Items inherit the feed author(s) when they don't declare their own
+		authors := jsonFeedAuthors(item.Author, item.Authors)
+		if authors == "" {
+			authors = jsonFeedAuthors(feed.Author, feed.Authors)
+		}
+
+		a := storage.Article{
+			Title:       item.Title,
+			Categories:  item.Tags,
+			Description: item.Summary,
+			Content:     content,
+			Author:      authors,
+			GUID:        item.ID,
+			Link:        item.URL,
+			Published:   published,
+			Updated:     updated,
+			Thumbnail:   item.Image,
+			Provider:    j.Label,
+		}
+		result = append(result, a)
+	}
+
+	return result, nil
+}
+
+// PollingFrequency returns the amount of time to wait between calls to `Latest()`
+func (j *JSONFeedProvider) PollingFrequency() time.Duration {
+	return j.PollFrequency
+}
+
+// jsonFeedAuthors combines the version 1.0 `author` and version 1.1 `authors` fields
+func jsonFeedAuthors(author *json.Author, authors []*json.Author) string {
+	if author != nil {
+		authors = append([]*json.Author{author}, authors...)
+	}
+	// Version 1.1 feeds commonly repeat `author` in `authors` for backwards compatibility
+	seen := map[string]bool{}
+	var names []string
+	for _, a := range authors {
+		if a == nil || a.Name == "" || seen[a.Name] {
+			continue
+		}
+		seen[a.Name] = true
+		names = append(names, a.Name)
+	}
+	return strings.Join(names, ", ")
+}
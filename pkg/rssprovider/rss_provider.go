@@ -1,6 +1,7 @@
 package rssprovider
 
 import (
+	"context"
 	"net/url"
 	"time"
 
@@ -14,6 +15,7 @@ type RSSProvider struct {
 	Label         string
 	FeedURL       string
 	PollFrequency time.Duration
+	conditional
 }
 
 // NewRSSProvider returns a new instance of RSSProvider
@@ -35,12 +37,19 @@ func NewRSSProvider(label, feedURL string, pollFrequency time.Duration) (*RSSPro
 }
 
 // Latest returns the latest items in the feed
-func (r *RSSProvider) Latest() ([]storage.Article, error) {
+func (r *RSSProvider) Latest(ctx context.Context) ([]storage.Article, error) {
+	body, state, err := fetch(ctx, r.FeedURL, r.state)
+	if err != nil {
+		return nil, errors.Wrap(err, "fetch rss feed")
+	}
+	defer body.Close()
+
 	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL(r.FeedURL)
+	feed, err := fp.Parse(body)
 	if err != nil {
-		return nil, errors.Wrap(err, "rss parse URL")
+		return nil, errors.Wrap(err, "rss parse")
 	}
+	r.state = state
 
 	var result []storage.Article
 	for _, item := range feed.Items {
@@ -49,18 +58,28 @@ func (r *RSSProvider) Latest() ([]storage.Article, error) {
 		if item.Image != nil {
 			imgURL = item.Image.URL
 		}
-		var published time.Time
+		var published, updated time.Time
 		if item.PublishedParsed != nil {
 			published = *item.PublishedParsed
 		}
+		if item.UpdatedParsed != nil {
+			updated = *item.UpdatedParsed
+		}
+		var author string
+		if item.Author != nil {
+			author = item.Author.Name
+		}
 
 		a := storage.Article{
 			Title:       item.Title,
 			Categories:  item.Categories,
 			Description: item.Description,
+			Content:     item.Content,
+			Author:      author,
 			GUID:        item.GUID,
 			Link:        item.Link,
 			Published:   published,
+			Updated:     updated,
 			Thumbnail:   imgURL,
 			Provider:    r.Label,
 		}
@@ -0,0 +1,222 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	// MinPollFrequency defines the minimum allowable time between polls
+	MinPollFrequency = 10 * time.Second // Useful to prevent possible rate limiting / abuse
+	// MaxPollFrequency defines the maximum allowable time between polls
+	MaxPollFrequency = 24 * time.Hour // Not really sure we need an upper limit but nice to have configurability
+)
+
+// Window is a time of day during which polling slows down or pauses. `Start` and `End` are "HH:MM" in the schedule's
+// time zone. If `End` is before `Start` the window runs over midnight.
+type Window struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	// PollFrequencySeconds is the time between polls during the window. Zero pauses polling until the window ends.
+	PollFrequencySeconds int `json:"pollFrequencySeconds,omitempty"`
+}
+
+// Schedule decides when a provider is polled. Polls are either a fixed interval apart or follow a cron expression, and
+// are slowed down or paused during quiet windows.
+type Schedule struct {
+	interval time.Duration
+	cron     cron.Schedule
+	windows  []window
+	location *time.Location
+}
+
+// window is a parsed Window
+type window struct {
+	start, end int // minutes after midnight
+	frequency  time.Duration
+}
+
+// New returns a new Schedule, or an error describing why the configuration isn't valid. `interval` is used when
+// `cronExpr` is empty. `cronExpr` is a standard five field cron expression or a descriptor such as `@hourly`.
+// `timezone` is an IANA time zone name used for the cron expression and windows, which defaults to UTC.
+func New(interval time.Duration, cronExpr string, windows []Window, timezone string) (*Schedule, error) {
+	s := &Schedule{
+		interval: interval,
+		location: time.UTC,
+	}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid time zone `%s`", timezone)
+		}
+		s.location = loc
+	}
+
+	if cronExpr != "" {
+		c, err := cron.ParseStandard(cronExpr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Invalid schedule `%s`", cronExpr)
+		}
+		// A five field expression can't be more frequent than once a minute, but `@every` can
+		if every, ok := c.(cron.ConstantDelaySchedule); ok && every.Delay < MinPollFrequency {
+			return nil, fmt.Errorf("Invalid schedule `%s`. Must not poll more than every %s", cronExpr, MinPollFrequency)
+		}
+		s.cron = c
+	} else if err := ValidateFrequency(interval); err != nil {
+		return nil, err
+	}
+
+	for _, w := range windows {
+		parsed, err := parseWindow(w)
+		if err != nil {
+			return nil, err
+		}
+		s.windows = append(s.windows, parsed)
+	}
+
+	return s, nil
+}
+
+// Next returns when to poll after a poll at `now`
+func (s *Schedule) Next(now time.Time) time.Time {
+	now = now.In(s.location)
+	next := s.next(now)
+
+	// Push the poll out of pause windows and slow it down in others. Bounded, as windows may overlap.
+	for i := 0; i <= len(s.windows); i++ {
+		w, active := s.activeWindow(next)
+		if !active {
+			break
+		}
+		end := w.endAfter(next)
+		if w.frequency == 0 {
+			// Resume when the window ends, or at the first cron time from then
+			next = end
+			if s.cron != nil {
+				next = s.cron.Next(end.Add(-time.Second))
+			}
+			continue
+		}
+		slowed := now.Add(w.frequency)
+		if slowed.After(end) {
+			slowed = end
+		}
+		if slowed.After(next) {
+			next = slowed
+		}
+		break
+	}
+
+	return next
+}
+
+// Interval returns the time between polls. It's zero if polls follow a cron expression.
+func (s *Schedule) Interval() time.Duration {
+	if s.cron != nil {
+		return 0
+	}
+	return s.interval
+}
+
+// WithInterval returns a copy of the schedule that polls every `interval`, keeping its quiet hours
+func (s *Schedule) WithInterval(interval time.Duration) *Schedule {
+	result := *s
+	result.interval = interval
+	result.cron = nil
+	return &result
+}
+
+// PausedUntil returns when a pause window active at `now` ends. False is returned if polling isn't paused.
+func (s *Schedule) PausedUntil(now time.Time) (time.Time, bool) {
+	now = now.In(s.location)
+	w, active := s.activeWindow(now)
+	if !active || w.frequency != 0 {
+		return time.Time{}, false
+	}
+	return w.endAfter(now), true
+}
+
+// next returns the next poll after `t`, ignoring windows
+func (s *Schedule) next(t time.Time) time.Time {
+	if s.cron != nil {
+		return s.cron.Next(t)
+	}
+	return t.Add(s.interval)
+}
+
+// activeWindow returns the first window that `t` falls in
+func (s *Schedule) activeWindow(t time.Time) (window, bool) {
+	minute := t.Hour()*60 + t.Minute()
+	for _, w := range s.windows {
+		if w.contains(minute) {
+			return w, true
+		}
+	}
+	return window{}, false
+}
+
+func (w window) contains(minute int) bool {
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	// Runs over midnight
+	return minute >= w.start || minute < w.end
+}
+
+// endAfter returns the first end of the window after `t`
+func (w window) endAfter(t time.Time) time.Time {
+	end := time.Date(t.Year(), t.Month(), t.Day(), w.end/60, w.end%60, 0, 0, t.Location())
+	if !end.After(t) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end
+}
+
+func parseWindow(w Window) (window, error) {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return window{}, errors.Wrap(err, "Invalid quiet hours start")
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return window{}, errors.Wrap(err, "Invalid quiet hours end")
+	}
+	if start == end {
+		return window{}, fmt.Errorf("Invalid quiet hours %s-%s. Start and end must differ", w.Start, w.End)
+	}
+
+	frequency := time.Duration(w.PollFrequencySeconds) * time.Second
+	if frequency != 0 {
+		if err := ValidateFrequency(frequency); err != nil {
+			return window{}, errors.Wrapf(err, "quiet hours %s-%s", w.Start, w.End)
+		}
+	}
+
+	return window{
+		start:     start,
+		end:       end,
+		frequency: frequency,
+	}, nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(clock string) (int, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return 0, fmt.Errorf("`%s` is not a time of day in the format HH:MM", clock)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// ValidateFrequency checks that `frequency` is within MinPollFrequency and MaxPollFrequency. If the poll frequency is
+// invalid we don't want to use default and result in unexpected behaviour by the operator. Better to let them know.
+func ValidateFrequency(frequency time.Duration) error {
+	if frequency < MinPollFrequency || frequency > MaxPollFrequency {
+		return fmt.Errorf("Invalid polling frequency, %d seconds. Must be inside range %d-%d", int(frequency.Seconds()), int(MinPollFrequency.Seconds()), int(MaxPollFrequency.Seconds()))
+	}
+	return nil
+}
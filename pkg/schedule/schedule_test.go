@@ -0,0 +1,186 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 10, day, hour, minute, 0, 0, time.UTC)
+	}
+	overnightPause := []Window{{Start: "22:00", End: "06:00"}}
+
+	tests := []struct {
+		name     string
+		interval time.Duration
+		cron     string
+		windows  []Window
+		timezone string
+		now      time.Time
+		want     time.Time
+	}{
+		{
+			name:     "interval",
+			interval: 5 * time.Minute,
+			now:      at(1, 10, 0),
+			want:     at(1, 10, 5),
+		},
+		{
+			name: "cron",
+			cron: "0 * * * *",
+			now:  at(1, 10, 20),
+			want: at(1, 11, 0),
+		},
+		{
+			name: "cron descriptor",
+			cron: "@daily",
+			now:  at(1, 10, 20),
+			want: at(2, 0, 0),
+		},
+		{
+			name:     "cron in time zone",
+			cron:     "0 9 * * *",
+			timezone: "America/New_York",
+			now:      at(1, 12, 0), // 08:00 EDT
+			want:     at(1, 13, 0),
+		},
+		{
+			name:     "outside pause window",
+			interval: time.Hour,
+			windows:  overnightPause,
+			now:      at(1, 20, 0),
+			want:     at(1, 21, 0),
+		},
+		{
+			name:     "pushed out of pause window over midnight",
+			interval: time.Hour,
+			windows:  overnightPause,
+			now:      at(1, 21, 30),
+			want:     at(2, 6, 0),
+		},
+		{
+			name:     "during pause window",
+			interval: time.Hour,
+			windows:  overnightPause,
+			now:      at(2, 1, 0),
+			want:     at(2, 6, 0),
+		},
+		{
+			name:    "cron resumes after pause window",
+			cron:    "30 * * * *",
+			windows: []Window{{Start: "00:00", End: "06:00"}},
+			now:     at(1, 23, 45),
+			want:    at(2, 6, 30),
+		},
+		{
+			name:    "cron on the end of pause window",
+			cron:    "0 * * * *",
+			windows: []Window{{Start: "00:00", End: "06:00"}},
+			now:     at(1, 23, 45),
+			want:    at(2, 6, 0),
+		},
+		{
+			name:     "slowed in window",
+			interval: 10 * time.Minute,
+			windows:  []Window{{Start: "00:00", End: "06:00", PollFrequencySeconds: 7200}},
+			now:      at(1, 1, 0),
+			want:     at(1, 3, 0),
+		},
+		{
+			name:     "slowed no later than the window end",
+			interval: 10 * time.Minute,
+			windows:  []Window{{Start: "00:00", End: "06:00", PollFrequencySeconds: 7200}},
+			now:      at(1, 5, 0),
+			want:     at(1, 6, 0),
+		},
+		{
+			name:     "pause window in time zone",
+			interval: time.Hour,
+			windows:  overnightPause,
+			timezone: "Europe/London",
+			now:      at(1, 20, 30), // 21:30 BST
+			want:     at(2, 5, 0),   // 06:00 BST
+		},
+		{
+			name:     "outside pause window in time zone",
+			interval: time.Hour,
+			windows:  overnightPause,
+			timezone: "Asia/Tokyo",
+			now:      at(1, 21, 30), // 06:30 JST
+			want:     at(1, 22, 30),
+		},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := New(tc.interval, tc.cron, tc.windows, tc.timezone)
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			got := s.Next(tc.now)
+			if !got.Equal(tc.want) {
+				t.Errorf("Next(%s) = %s, want %s", tc.now, got.UTC(), tc.want)
+			}
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		cron     string
+		windows  []Window
+		timezone string
+	}{
+		{name: "interval too short", interval: 5 * time.Second},
+		{name: "interval too long", interval: 25 * time.Hour},
+		{name: "cron", cron: "not a schedule"},
+		{name: "cron too frequent", cron: "@every 5s"},
+		{name: "time zone", interval: time.Minute, timezone: "Mars/Olympus_Mons"},
+		{name: "window start", interval: time.Minute, windows: []Window{{Start: "25:00", End: "06:00"}}},
+		{name: "window end", interval: time.Minute, windows: []Window{{Start: "22:00", End: "6pm"}}},
+		{name: "empty window", interval: time.Minute, windows: []Window{{Start: "22:00", End: "22:00"}}},
+		{name: "window frequency", interval: time.Minute, windows: []Window{{Start: "22:00", End: "06:00", PollFrequencySeconds: 5}}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New(tc.interval, tc.cron, tc.windows, tc.timezone)
+			if err == nil {
+				t.Errorf("New() error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestPausedUntil(t *testing.T) {
+	s, err := New(time.Hour, "", []Window{
+		{Start: "22:00", End: "06:00"},
+		{Start: "12:00", End: "13:00", PollFrequencySeconds: 1800},
+	}, "")
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	tests := []struct {
+		name       string
+		now        time.Time
+		wantPaused bool
+		want       time.Time
+	}{
+		{"before midnight", time.Date(2020, 10, 1, 23, 0, 0, 0, time.UTC), true, time.Date(2020, 10, 2, 6, 0, 0, 0, time.UTC)},
+		{"after midnight", time.Date(2020, 10, 2, 1, 0, 0, 0, time.UTC), true, time.Date(2020, 10, 2, 6, 0, 0, 0, time.UTC)},
+		{"window end", time.Date(2020, 10, 2, 6, 0, 0, 0, time.UTC), false, time.Time{}},
+		{"slowed window", time.Date(2020, 10, 2, 12, 30, 0, 0, time.UTC), false, time.Time{}},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, paused := s.PausedUntil(tc.now)
+			if paused != tc.wantPaused || !got.Equal(tc.want) {
+				t.Errorf("PausedUntil(%s) = %s, %t, want %s, %t", tc.now, got, paused, tc.want, tc.wantPaused)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidCursor is returned when a cursor can't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrInvalidQuery is returned when a query for articles can't be run as it is
+type ErrInvalidQuery struct {
+	Message string
+}
+
+func (e ErrInvalidQuery) Error() string {
+	return e.Message
+}
+
+// Search ranks
+const (
+	// RankRelevance orders search results by how well they match the search text, then newest first
+	RankRelevance = "relevance"
+	// RankRecency orders search results newest first
+	RankRecency = "recency"
+)
+
+// Article sort fields
+const (
+	SortPublished = "published"
+	SortIngested  = "ingested"
+	SortTitle     = "title"
+)
+
+// Sort orders
+const (
+	OrderAscending  = "asc"
+	OrderDescending = "desc"
+)
+
+// ArticleFields are the names of the article fields that can be selected by `ArticleQuery.Fields`
+var ArticleFields = []string{
+	"id", "providerID", "title", "link", "description", "content", "author", "published", "updated", "ingested", "guid",
+	"thumbnail", "categories", "provider",
+}
+
+// ArticleQuery selects a page of articles. Pages follow `Cursor` if it's set, otherwise `Offset` counts pages of `Count`
+// articles.
+type ArticleQuery struct {
+	Offset     int
+	Count      int
+	Cursor     string
+	Categories []string
+	Providers  []string
+	// Since and Until limit the articles to those published in the range. Zero values don't limit it.
+	Since time.Time
+	Until time.Time
+	// Sort is the field to order articles by, `SortPublished` if empty. Ties are ordered by ID.
+	Sort string
+	// Order is the direction of the sort. It defaults to newest first, or A-Z for titles.
+	Order string
+	// Fields selects which fields of the articles are returned, all of them if empty. The ID is always returned.
+	Fields []string
+}
+
+// SortField returns the field to order articles by
+func (q ArticleQuery) SortField() string {
+	if q.Sort == "" {
+		return SortPublished
+	}
+	return q.Sort
+}
+
+// Descending reports whether articles are in descending order
+func (q ArticleQuery) Descending() bool {
+	if q.Order == "" {
+		return q.SortField() != SortTitle
+	}
+	return q.Order == OrderDescending
+}
+
+// Validate checks the query can be run
+func (q ArticleQuery) Validate() error {
+	switch q.SortField() {
+	case SortPublished, SortIngested, SortTitle:
+	default:
+		return ErrInvalidQuery{Message: fmt.Sprintf("`%s` is not a sort field, use `%s`, `%s` or `%s`", q.Sort, SortPublished, SortIngested, SortTitle)}
+	}
+	if q.Order != "" && q.Order != OrderAscending && q.Order != OrderDescending {
+		return ErrInvalidQuery{Message: fmt.Sprintf("`%s` is not a sort order, use `%s` or `%s`", q.Order, OrderAscending, OrderDescending)}
+	}
+	if !q.Since.IsZero() && !q.Until.IsZero() && q.Until.Before(q.Since) {
+		return ErrInvalidQuery{Message: "until must not be before since"}
+	}
+	for _, field := range q.Fields {
+		if !isArticleField(field) {
+			return ErrInvalidQuery{Message: fmt.Sprintf("`%s` is not an article field", field)}
+		}
+	}
+	return nil
+}
+
+func isArticleField(field string) bool {
+	for _, f := range ArticleFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchQuery selects a page of articles whose title or description match `Text`. Pages of `Count` articles are
+// counted by `Offset`.
+type SearchQuery struct {
+	Text       string
+	Rank       string
+	Offset     int
+	Count      int
+	Categories []string
+	Providers  []string
+}
+
+// Validate checks the search can be run
+func (q SearchQuery) Validate() error {
+	if q.Text == "" {
+		return ErrInvalidQuery{Message: "search text is required"}
+	}
+	if q.Rank != RankRelevance && q.Rank != RankRecency {
+		return ErrInvalidQuery{Message: fmt.Sprintf("`%s` is not a search rank, use `%s` or `%s`", q.Rank, RankRelevance, RankRecency)}
+	}
+	return nil
+}
+
+// Words splits `text` into the lower case words used for full-text search. Words are only letters and numbers, so they
+// can be used in a search expression without escaping.
+func Words(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// ArticlePage is a page of articles. `NextCursor` selects the page after it, and is empty if there are no more.
+type ArticlePage struct {
+	Articles   []Article `json:"articles,omitempty"`
+	NextCursor string    `json:"nextCursor,omitempty"`
+}
+
+// Cursor is the position of an article in a listing. Articles are ordered by the sort field, then ID, so the position
+// doesn't move as newer articles arrive.
+type Cursor struct {
+	Sort       string    `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	Time       time.Time `json:"t,omitempty"`
+	Title      string    `json:"v,omitempty"`
+	ID         string    `json:"i"`
+}
+
+// CursorAfter returns the cursor for the page after `article` in the listing selected by `query`
+func CursorAfter(article Article, query ArticleQuery) string {
+	c := Cursor{
+		Sort:       query.SortField(),
+		Descending: query.Descending(),
+		ID:         article.ID,
+	}
+	switch c.Sort {
+	case SortPublished:
+		c.Time = article.Published
+	case SortIngested:
+		c.Time = article.Ingested
+	case SortTitle:
+		c.Title = article.Title
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor returns the position encoded in the query's cursor. `ErrInvalidCursor` is returned if it's not a cursor
+// returned by `CursorAfter()` for a query with the same order.
+func DecodeCursor(query ArticleQuery) (Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(query.Cursor)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	var result Cursor
+	err = json.Unmarshal(b, &result)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	if result.Sort != query.SortField() || result.Descending != query.Descending() {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return result, nil
+}
+
+// Limit returns how many articles to fetch for a page, which is one more than the count so `NewArticlePage` can tell
+// whether there are more. It's zero, for no limit, if the count is.
+func (q ArticleQuery) Limit() int {
+	if q.Count <= 0 {
+		return 0
+	}
+	return q.Count + 1
+}
+
+// NewArticlePage returns the page of `articles` fetched for `query`, up to its limit. The article after the page, if
+// there is one, isn't returned but gives the page a cursor for the next.
+func NewArticlePage(articles []Article, query ArticleQuery) ArticlePage {
+	if query.Count <= 0 || len(articles) <= query.Count {
+		return ArticlePage{Articles: articles}
+	}
+	articles = articles[:query.Count]
+	return ArticlePage{
+		Articles:   articles,
+		NextCursor: CursorAfter(articles[len(articles)-1], query),
+	}
+}
@@ -2,23 +2,118 @@ package storage
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
 )
 
 // Article defines a news article
 type Article struct {
+	// ID is stable and URL safe, see `ArticleID()`
+	ID          string    `json:"id,omitempty"`
+	ProviderID  string    `json:"providerID,omitempty"`
 	Title       string    `json:"title,omitempty"`
 	Link        string    `json:"link,omitempty"`
 	Description string    `json:"description,omitempty"`
+	Content     string    `json:"content,omitempty"`
+	Author      string    `json:"author,omitempty"`
 	Published   time.Time `json:"published,omitempty"`
-	GUID        string    `json:"guid,omitempty"`
-	Thumbnail   string    `json:"thumbnail,omitempty"`
-	Categories  []string  `json:"categories,omitempty"`
-	Provider    string    `json:"provider,omitempty"`
+	Updated     time.Time `json:"updated,omitempty"`
+	// Ingested is when the article was first stored
+	Ingested   time.Time `json:"ingested,omitempty" bson:"ingested,omitempty"`
+	GUID       string    `json:"guid,omitempty"`
+	Thumbnail  string    `json:"thumbnail,omitempty"`
+	Categories []string  `json:"categories,omitempty"`
+	Provider   string    `json:"provider,omitempty"`
+}
+
+// MarshalJSON leaves out times that aren't set, such as those not selected by `ArticleQuery.Fields`
+func (a Article) MarshalJSON() ([]byte, error) {
+	type article Article
+	out := struct {
+		article
+		Published *time.Time `json:"published,omitempty"`
+		Updated   *time.Time `json:"updated,omitempty"`
+		Ingested  *time.Time `json:"ingested,omitempty"`
+	}{
+		article: article(a),
+	}
+	if !a.Published.IsZero() {
+		out.Published = &a.Published
+	}
+	if !a.Updated.IsZero() {
+		out.Updated = &a.Updated
+	}
+	if !a.Ingested.IsZero() {
+		out.Ingested = &a.Ingested
+	}
+	return json.Marshal(out)
+}
+
+// ArticleID returns the ID of the article with `guid` from the provider related to `providerID`. It's the same each
+// time the article is fetched, and safe to use in URLs.
+func ArticleID(providerID, guid string) string {
+	sum := sha256.Sum256([]byte(providerID + "\x00" + guid))
+	return base64.RawURLEncoding.EncodeToString(sum[:16])
+}
+
+// InsertResult reports what inserting articles did to each of them. Articles are identified by ID.
+type InsertResult struct {
+	// Inserted are articles that weren't stored before
+	Inserted []string `json:"inserted,omitempty"`
+	// Modified are stored articles that have changed
+	Modified []string `json:"modified,omitempty"`
+	// Unchanged are stored articles that are the same as before
+	Unchanged []string `json:"unchanged,omitempty"`
+}
+
+// ArticleError is a failure to insert a single article
+type ArticleError struct {
+	GUID    string `json:"guid"`
+	Message string `json:"message"`
+}
+
+// InsertErrors is returned by InsertArticles when some of the articles couldn't be saved. The InsertResult returned
+// with it reports the articles that were.
+type InsertErrors []ArticleError
+
+func (e InsertErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, ae := range e {
+		msgs = append(msgs, fmt.Sprintf("`%s`: %s", ae.GUID, ae.Message))
+	}
+	return fmt.Sprintf("unable to save %d articles - %s", len(e), strings.Join(msgs, "; "))
+}
+
+// ExpiryQuery selects articles that have been stored long enough to be removed by a retention policy
+type ExpiryQuery struct {
+	// Before is the time articles must have been ingested before to expire
+	Before time.Time
+	// ProviderIDs limits the articles to those from the providers, if set. ExcludeProviderIDs leaves out the articles
+	// from the providers, for those with their own retention policy.
+	ProviderIDs        []string
+	ExcludeProviderIDs []string
+	// Count is the most articles returned
+	Count int
 }
 
 // ArticleRepository defines functionality to CRUD articles in underlying store
 type ArticleRepository interface {
-	InsertArticles(ctx context.Context, p []Article) ([]string, error)
-	GetArticles(ctx context.Context, offset, count int, category, provider []string) ([]Article, error)
+	// InsertArticles inserts new articles and updates existing ones, matched by ID. Articles without an ID are given
+	// `ArticleID()`. `InsertErrors` is returned if only some of the articles could be saved.
+	InsertArticles(ctx context.Context, p []Article) (InsertResult, error)
+	// GetArticles returns the page of articles selected by `query`. `ErrInvalidCursor` is returned if the query's cursor
+	// can't be decoded.
+	GetArticles(ctx context.Context, query ArticleQuery) (ArticlePage, error)
+	// Search returns the page of articles whose title or description match the query's text
+	Search(ctx context.Context, query SearchQuery) ([]Article, error)
+	// GetArticle returns the article related to `articleID`. `ErrNotFound` is returned if there's no such article.
+	GetArticle(ctx context.Context, articleID string) (Article, error)
+	// ExpiredArticles returns the articles selected by `query`, oldest ingested first
+	ExpiredArticles(ctx context.Context, query ExpiryQuery) ([]Article, error)
+	// DeleteArticles deletes the articles related to `articleIDs`, returning how many were deleted
+	DeleteArticles(ctx context.Context, articleIDs []string) (int, error)
 }
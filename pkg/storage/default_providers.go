@@ -0,0 +1,31 @@
+package storage
+
+// DefaultProviders returns the providers a new store is bootstrapped with, so there's news to aggregate straight away
+func DefaultProviders() []Provider {
+	return []Provider{
+		{
+			Type:                 "rss",
+			FeedURL:              "http://feeds.bbci.co.uk/news/uk/rss.xml",
+			Label:                "BBC News UK",
+			PollFrequencySeconds: 300,
+		},
+		{
+			Type:                 "rss",
+			FeedURL:              "http://feeds.bbci.co.uk/news/technology/rss.xml",
+			Label:                "BBC News Technology",
+			PollFrequencySeconds: 300,
+		},
+		{
+			Type:                 "rss",
+			FeedURL:              "http://feeds.skynews.com/feeds/rss/uk.xml",
+			Label:                "Sky News UK",
+			PollFrequencySeconds: 300,
+		},
+		{
+			Type:                 "rss",
+			FeedURL:              "http://feeds.skynews.com/feeds/rss/technology.xml",
+			Label:                "Sky News Technology",
+			PollFrequencySeconds: 300,
+		},
+	}
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// Lease grants an owner exclusive use of a named resource until it expires
+type Lease struct {
+	Name    string    `json:"name,omitempty"`
+	Owner   string    `json:"owner,omitempty"`
+	Expires time.Time `json:"expires,omitempty"`
+}
+
+// LeaseRepository defines functionality to manage leases in a store shared by every instance of a service. Expiry is
+// based on the clock of the instance taking the lease, so instances are expected to have reasonably synchronised clocks.
+type LeaseRepository interface {
+	// AcquireLease takes the lease `name` for `owner` for the duration `ttl`, or extends it if `owner` already holds
+	// it. False is returned if the lease is held by another owner and hasn't expired.
+	AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error)
+	// ReleaseLease gives up the lease `name` if it is held by `owner`
+	ReleaseLease(ctx context.Context, name, owner string) error
+	// GetLeases returns the unexpired leases with names beginning with `prefix`
+	GetLeases(ctx context.Context, prefix string) ([]Lease, error)
+}
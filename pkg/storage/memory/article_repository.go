@@ -0,0 +1,364 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+// Search weights, matching the Mongo text index
+const (
+	titleWeight       = 3
+	descriptionWeight = 1
+)
+
+// ArticleRepository is a thread safe, in-memory implementation of `storage.ArticleRepository`. It filters, sorts and
+// pages articles the same as the Mongo implementation.
+type ArticleRepository struct {
+	mu sync.RWMutex
+	// articles are keyed by ID, which articles are upserted by
+	articles map[string]storage.Article
+}
+
+// NewArticleRepository returns an empty ArticleRepository
+func NewArticleRepository() *ArticleRepository {
+	return &ArticleRepository{
+		articles: map[string]storage.Article{},
+	}
+}
+
+// InsertArticles upserts articles by ID, reporting which were inserted, modified or unchanged
+func (ar *ArticleRepository) InsertArticles(ctx context.Context, articles []storage.Article) (storage.InsertResult, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	var result storage.InsertResult
+	now := time.Now()
+	for _, art := range articles {
+		art = copyArticle(art)
+		if art.ID == "" {
+			art.ID = storage.ArticleID(art.ProviderID, art.GUID)
+		}
+		stored, ok := ar.articles[art.ID]
+		switch {
+		case !ok:
+			art.Ingested = now
+			result.Inserted = append(result.Inserted, art.ID)
+		case sameArticle(stored, art):
+			result.Unchanged = append(result.Unchanged, art.ID)
+			continue
+		default:
+			art.Ingested = stored.Ingested
+			result.Modified = append(result.Modified, art.ID)
+		}
+		ar.articles[art.ID] = art
+	}
+	return result, nil
+}
+
+// GetArticle returns the article related to `articleID`. `storage.ErrNotFound` is returned if there's no such article.
+func (ar *ArticleRepository) GetArticle(ctx context.Context, articleID string) (storage.Article, error) {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	art, ok := ar.articles[articleID]
+	if ok {
+		return copyArticle(art), nil
+	}
+	return storage.Article{}, storage.ErrNotFound{
+		Message: fmt.Sprintf("No article found for ID `%s`", articleID),
+	}
+}
+
+// GetArticles returns a page of articles in the query's order. Pages follow the query's cursor if it's set, otherwise
+// they're skipped by offset.
+func (ar *ArticleRepository) GetArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error) {
+	err := query.Validate()
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+
+	var after *storage.Article
+	if query.Cursor != "" {
+		cursor, err := storage.DecodeCursor(query)
+		if err != nil {
+			return storage.ArticlePage{}, err
+		}
+		after = &storage.Article{
+			ID:        cursor.ID,
+			Title:     cursor.Title,
+			Published: cursor.Time,
+			Ingested:  cursor.Time,
+		}
+	}
+
+	ar.mu.RLock()
+	var matches []storage.Article
+	for _, art := range ar.articles {
+		if !matchesFilters(art, query.Categories, query.Providers) {
+			continue
+		}
+		if !query.Since.IsZero() && art.Published.Before(query.Since) {
+			continue
+		}
+		if !query.Until.IsZero() && !art.Published.Before(query.Until) {
+			continue
+		}
+		matches = append(matches, art)
+	}
+	ar.mu.RUnlock()
+
+	less := articleOrder(query.SortField(), query.Descending())
+	sort.Slice(matches, func(i, j int) bool {
+		return less(matches[i], matches[j])
+	})
+
+	skip := query.Offset * query.Count
+	if after != nil {
+		// Keyset pagination, so the page starts after the cursor regardless of what's been inserted since
+		skip = sort.Search(len(matches), func(i int) bool {
+			return less(*after, matches[i])
+		})
+	}
+	var results []storage.Article
+	for _, i := range page(len(matches), skip, query.Limit()) {
+		results = append(results, selectFields(copyArticle(matches[i]), query))
+	}
+
+	return storage.NewArticlePage(results, query), nil
+}
+
+// Search returns a page of articles whose title or description contain any of the words in the query's text. Matches
+// in the title count for more.
+func (ar *ArticleRepository) Search(ctx context.Context, query storage.SearchQuery) ([]storage.Article, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	terms := storage.Words(query.Text)
+
+	type match struct {
+		article storage.Article
+		score   int
+	}
+	var matches []match
+	ar.mu.RLock()
+	for _, art := range ar.articles {
+		if !matchesFilters(art, query.Categories, query.Providers) {
+			continue
+		}
+		score := titleWeight*countWords(art.Title, terms) + descriptionWeight*countWords(art.Description, terms)
+		if score > 0 {
+			matches = append(matches, match{article: art, score: score})
+		}
+	}
+	ar.mu.RUnlock()
+
+	newest := articleOrder(storage.SortPublished, true)
+	sort.Slice(matches, func(i, j int) bool {
+		if query.Rank == storage.RankRelevance && matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return newest(matches[i].article, matches[j].article)
+	})
+
+	var results []storage.Article
+	for _, i := range page(len(matches), query.Offset*query.Count, query.Count) {
+		results = append(results, copyArticle(matches[i].article))
+	}
+	return results, nil
+}
+
+// ExpiredArticles returns the articles selected by `query`, oldest ingested first
+func (ar *ArticleRepository) ExpiredArticles(ctx context.Context, query storage.ExpiryQuery) ([]storage.Article, error) {
+	ar.mu.RLock()
+	var matches []storage.Article
+	for _, art := range ar.articles {
+		if !art.Ingested.Before(query.Before) {
+			continue
+		}
+		if len(query.ProviderIDs) > 0 && !containsAny([]string{art.ProviderID}, query.ProviderIDs) {
+			continue
+		}
+		if containsAny([]string{art.ProviderID}, query.ExcludeProviderIDs) {
+			continue
+		}
+		matches = append(matches, art)
+	}
+	ar.mu.RUnlock()
+
+	oldest := articleOrder(storage.SortIngested, false)
+	sort.Slice(matches, func(i, j int) bool {
+		return oldest(matches[i], matches[j])
+	})
+
+	var results []storage.Article
+	for _, i := range page(len(matches), 0, query.Count) {
+		results = append(results, copyArticle(matches[i]))
+	}
+	return results, nil
+}
+
+// DeleteArticles deletes the articles related to `articleIDs`, returning how many were deleted
+func (ar *ArticleRepository) DeleteArticles(ctx context.Context, articleIDs []string) (int, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	deleted := 0
+	for _, id := range articleIDs {
+		if _, ok := ar.articles[id]; ok {
+			delete(ar.articles, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// articleOrder returns a function reporting whether article `a` comes before `b`, when ordered by `sortField` then ID
+func articleOrder(sortField string, descending bool) func(a, b storage.Article) bool {
+	compare := func(a, b storage.Article) int {
+		switch sortField {
+		case storage.SortTitle:
+			if c := strings.Compare(a.Title, b.Title); c != 0 {
+				return c
+			}
+		case storage.SortIngested:
+			if c := compareTimes(a.Ingested, b.Ingested); c != 0 {
+				return c
+			}
+		default:
+			if c := compareTimes(a.Published, b.Published); c != 0 {
+				return c
+			}
+		}
+		return strings.Compare(a.ID, b.ID)
+	}
+	return func(a, b storage.Article) bool {
+		if descending {
+			return compare(a, b) > 0
+		}
+		return compare(a, b) < 0
+	}
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+// matchesFilters reports whether `art` is in any of `categories` and from any of `providers`. Empty filters match
+// every article.
+func matchesFilters(art storage.Article, categories, providers []string) bool {
+	if len(categories) > 0 && !containsAny(art.Categories, categories) {
+		return false
+	}
+	if len(providers) > 0 && !containsAny([]string{art.Provider}, providers) {
+		return false
+	}
+	return true
+}
+
+func containsAny(values, wanted []string) bool {
+	for _, v := range values {
+		for _, w := range wanted {
+			if v == w {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// countWords returns how many of the words in `text` are one of `terms`
+func countWords(text string, terms []string) int {
+	count := 0
+	for _, w := range storage.Words(text) {
+		for _, t := range terms {
+			if w == t {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// selectFields clears the fields of `art` that aren't selected by the query. The ID and sort field are always kept, as
+// they're needed for the next cursor.
+func selectFields(art storage.Article, query storage.ArticleQuery) storage.Article {
+	if len(query.Fields) == 0 {
+		return art
+	}
+	keep := map[string]bool{
+		"id":               true,
+		query.SortField(): true,
+	}
+	for _, f := range query.Fields {
+		keep[f] = true
+	}
+
+	var result storage.Article
+	fields := map[string]func(){
+		"id":          func() { result.ID = art.ID },
+		"providerID":  func() { result.ProviderID = art.ProviderID },
+		"title":       func() { result.Title = art.Title },
+		"link":        func() { result.Link = art.Link },
+		"description": func() { result.Description = art.Description },
+		"content":     func() { result.Content = art.Content },
+		"author":      func() { result.Author = art.Author },
+		"published":   func() { result.Published = art.Published },
+		"updated":     func() { result.Updated = art.Updated },
+		"ingested":    func() { result.Ingested = art.Ingested },
+		"guid":        func() { result.GUID = art.GUID },
+		"thumbnail":   func() { result.Thumbnail = art.Thumbnail },
+		"categories":  func() { result.Categories = art.Categories },
+		"provider":    func() { result.Provider = art.Provider },
+	}
+	for f := range keep {
+		if set, ok := fields[f]; ok {
+			set()
+		}
+	}
+	return result
+}
+
+// sameArticle reports whether the stored article `stored` already holds `art`. Ingested isn't compared, as it's set by
+// the repository.
+func sameArticle(stored, art storage.Article) bool {
+	if len(stored.Categories) != len(art.Categories) {
+		return false
+	}
+	for i := range stored.Categories {
+		if stored.Categories[i] != art.Categories[i] {
+			return false
+		}
+	}
+	return stored.ID == art.ID &&
+		stored.ProviderID == art.ProviderID &&
+		stored.Title == art.Title &&
+		stored.Link == art.Link &&
+		stored.Description == art.Description &&
+		stored.Content == art.Content &&
+		stored.Author == art.Author &&
+		stored.Published.Equal(art.Published) &&
+		stored.Updated.Equal(art.Updated) &&
+		stored.Thumbnail == art.Thumbnail &&
+		stored.Provider == art.Provider
+}
+
+// copyArticle returns a copy of `art` that doesn't share slices with it
+func copyArticle(art storage.Article) storage.Article {
+	if art.Categories != nil {
+		art.Categories = append(art.Categories[:0:0], art.Categories...)
+	}
+	return art
+}
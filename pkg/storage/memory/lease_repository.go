@@ -0,0 +1,71 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+// LeaseRepository is a thread safe, in-memory implementation of `storage.LeaseRepository`. Leases are only shared
+// within a process, so it's only useful for running a single aggregator.
+type LeaseRepository struct {
+	mu     sync.Mutex
+	leases map[string]storage.Lease
+}
+
+// NewLeaseRepository returns an empty LeaseRepository
+func NewLeaseRepository() *LeaseRepository {
+	return &LeaseRepository{
+		leases: map[string]storage.Lease{},
+	}
+}
+
+// AcquireLease takes or extends the lease `name` for `owner`
+func (lr *LeaseRepository) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	now := time.Now()
+	if l, ok := lr.leases[name]; ok && l.Owner != owner && !l.Expires.Before(now) {
+		return false, nil
+	}
+	lr.leases[name] = storage.Lease{
+		Name:    name,
+		Owner:   owner,
+		Expires: now.Add(ttl),
+	}
+	return true, nil
+}
+
+// ReleaseLease deletes the lease `name` if it's held by `owner`
+func (lr *LeaseRepository) ReleaseLease(ctx context.Context, name, owner string) error {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if l, ok := lr.leases[name]; ok && l.Owner == owner {
+		delete(lr.leases, name)
+	}
+	return nil
+}
+
+// GetLeases returns the unexpired leases with names beginning with `prefix`
+func (lr *LeaseRepository) GetLeases(ctx context.Context, prefix string) ([]storage.Lease, error) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	now := time.Now()
+	result := []storage.Lease{}
+	for name, l := range lr.leases {
+		if strings.HasPrefix(name, prefix) && !l.Expires.Before(now) {
+			result = append(result, l)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
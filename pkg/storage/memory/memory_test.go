@@ -0,0 +1,26 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/chackett/zignews/pkg/storage/storagetest"
+)
+
+func TestArticleRepository(t *testing.T) {
+	storagetest.TestArticleRepository(t, func(t *testing.T) storage.ArticleRepository {
+		return NewArticleRepository()
+	})
+}
+
+func TestProviderRepository(t *testing.T) {
+	storagetest.TestProviderRepository(t, func(t *testing.T) storage.ProviderRepository {
+		return NewProviderRepository()
+	})
+}
+
+func TestLeaseRepository(t *testing.T) {
+	storagetest.TestLeaseRepository(t, func(t *testing.T) storage.LeaseRepository {
+		return NewLeaseRepository()
+	})
+}
@@ -0,0 +1,179 @@
+package memory
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// ProviderRepository is a thread safe, in-memory implementation of `storage.ProviderRepository`
+type ProviderRepository struct {
+	mu sync.RWMutex
+	// providers are held in the order they were inserted, like the Mongo natural order
+	providers []storage.Provider
+}
+
+// NewProviderRepository returns an empty ProviderRepository
+func NewProviderRepository() *ProviderRepository {
+	return &ProviderRepository{}
+}
+
+// InsertProviders inserts providers, returning their generated IDs
+func (pr *ProviderRepository) InsertProviders(ctx context.Context, providers []storage.Provider) ([]string, error) {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	var insertedIDs []string
+	for _, p := range providers {
+		id, err := newID()
+		if err != nil {
+			return nil, errors.Wrap(err, "generate provider id")
+		}
+		p.ID = id
+		pr.providers = append(pr.providers, copyProvider(p))
+		insertedIDs = append(insertedIDs, id)
+	}
+	return insertedIDs, nil
+}
+
+// GetProviders returns a page of providers. `offset` counts pages of `count` providers.
+func (pr *ProviderRepository) GetProviders(ctx context.Context, offset, count int) ([]storage.Provider, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	var results []storage.Provider
+	for _, p := range page(len(pr.providers), offset*count, count) {
+		results = append(results, copyProvider(pr.providers[p]))
+	}
+	return results, nil
+}
+
+// GetProvider returns the provider related to the specified `providerID`. `storage.ErrNotFound` is returned if there's
+// no such provider.
+func (pr *ProviderRepository) GetProvider(ctx context.Context, providerID string) (storage.Provider, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	i, ok := pr.index(providerID)
+	if !ok {
+		return storage.Provider{}, providerNotFound(providerID)
+	}
+	return copyProvider(pr.providers[i]), nil
+}
+
+// UpdateProvider replaces the configuration of the provider related to `provider.ID`, resetting its fetch state, poll
+// status and learned poll frequency. `storage.ErrNotFound` is returned if there's no such provider.
+func (pr *ProviderRepository) UpdateProvider(ctx context.Context, provider storage.Provider) error {
+	return pr.update(provider.ID, func(p *storage.Provider) {
+		*p = copyProvider(provider)
+		p.FetchState = storage.FetchState{}
+		p.Status = storage.PollStatus{}
+		p.LearnedPollFrequencySeconds = 0
+	})
+}
+
+// DeleteProvider deletes the provider related to `providerID`. `storage.ErrNotFound` is returned if there's no such
+// provider.
+func (pr *ProviderRepository) DeleteProvider(ctx context.Context, providerID string) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	i, ok := pr.index(providerID)
+	if !ok {
+		return providerNotFound(providerID)
+	}
+	pr.providers = append(pr.providers[:i], pr.providers[i+1:]...)
+	return nil
+}
+
+// UpdateFetchState replaces the fetch state of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdateFetchState(ctx context.Context, providerID string, state storage.FetchState) error {
+	return pr.update(providerID, func(p *storage.Provider) {
+		p.FetchState = state
+	})
+}
+
+// UpdatePollStatus replaces the poll status of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdatePollStatus(ctx context.Context, providerID string, status storage.PollStatus) error {
+	return pr.update(providerID, func(p *storage.Provider) {
+		p.Status = status
+	})
+}
+
+// UpdateLearnedPollFrequency records the poll frequency learned by adaptive polling of the provider related to the
+// specified `providerID`
+func (pr *ProviderRepository) UpdateLearnedPollFrequency(ctx context.Context, providerID string, seconds int) error {
+	return pr.update(providerID, func(p *storage.Provider) {
+		p.LearnedPollFrequencySeconds = seconds
+	})
+}
+
+// update applies `fn` to the provider related to `providerID`. `storage.ErrNotFound` is returned if there's no such
+// provider.
+func (pr *ProviderRepository) update(providerID string, fn func(p *storage.Provider)) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+
+	i, ok := pr.index(providerID)
+	if !ok {
+		return providerNotFound(providerID)
+	}
+	fn(&pr.providers[i])
+	pr.providers[i].ID = providerID
+	return nil
+}
+
+func (pr *ProviderRepository) index(providerID string) (int, bool) {
+	for i, p := range pr.providers {
+		if p.ID == providerID {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func providerNotFound(providerID string) error {
+	return storage.ErrNotFound{
+		Message: fmt.Sprintf("No provider found for ID `%s`", providerID),
+	}
+}
+
+// copyProvider returns a copy of `p` that doesn't share slices with it
+func copyProvider(p storage.Provider) storage.Provider {
+	if p.QuietHours != nil {
+		p.QuietHours = append(p.QuietHours[:0:0], p.QuietHours...)
+	}
+	return p
+}
+
+// newID returns a random ID in the same format as a Mongo ObjectID
+func newID() (string, error) {
+	b := make([]byte, 12)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// page returns the indexes of the items in a page of `count` items starting at `skip`, from `total` items. A `count`
+// of zero means no limit, as it does for Mongo.
+func page(total, skip, count int) []int {
+	if skip < 0 {
+		skip = 0
+	}
+	end := total
+	if count > 0 && skip+count < end {
+		end = skip + count
+	}
+	var result []int
+	for i := skip; i < end; i++ {
+		result = append(result, i)
+	}
+	return result
+}
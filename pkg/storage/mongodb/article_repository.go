@@ -3,7 +3,7 @@ package mongodb
 import (
 	"context"
 	"fmt"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/chackett/zignews/pkg/storage"
@@ -17,95 +17,358 @@ const collectionArticles = "articles"
 
 // ArticleRepository is an implementation to create/retrieve articles from MongoBD store
 type ArticleRepository struct {
-	client   *mongo.Client
 	database *mongo.Database
 }
 
-// NewArticleRepository ..
-func NewArticleRepository(connection, user, password, dbName string) (*ArticleRepository, error) {
-	URI := fmt.Sprintf("mongodb://%s:%s@%s", user, password, connection)
-	_client, err := mongo.NewClient(options.Client().ApplyURI(URI))
-	if err != nil {
-		return nil, errors.Wrap(err, "mongo.NewClient()")
+// NewArticleRepository returns an ArticleRepository using the database of `client`, which must have been migrated
+func NewArticleRepository(client *Client) *ArticleRepository {
+	return &ArticleRepository{
+		database: client.database,
 	}
-	err = _client.Connect(context.Background())
-	if err != nil {
-		return nil, errors.Wrap(err, "mongo client.Connect()")
+}
+
+// InsertArticles upserts a collection of articles into the article collection by ID, reporting which were inserted, modified
+// or unchanged. Existing articles are fetched in one query so unchanged ones aren't written, then the rest are upserted
+// in a single unordered bulk write. `storage.InsertErrors` is returned if some of the writes fail.
+func (pr *ArticleRepository) InsertArticles(ctx context.Context, articles []storage.Article) (storage.InsertResult, error) {
+	var result storage.InsertResult
+	c := pr.database.Collection(collectionArticles)
+	if c == nil {
+		return result, fmt.Errorf("unable to get collection handler for %s", collectionArticles)
+	}
+
+	articles = uniqueArticles(articles)
+	if len(articles) == 0 {
+		return result, nil
 	}
 
-	_database := _client.Database(dbName)
+	existing, err := pr.existingArticles(ctx, c, articles)
+	if err != nil {
+		return result, errors.Wrap(err, "get existing articles")
+	}
 
-	result := ArticleRepository{
-		client:   _client,
-		database: _database,
+	now := time.Now()
+	var (
+		models []mongo.WriteModel
+		// writes holds the article written by each model
+		writes []storage.Article
+	)
+	for _, art := range articles {
+		// Ingested is only ever set when an article is first stored
+		art.Ingested = time.Time{}
+		stored, ok := existing[art.ID]
+		if ok && sameArticle(stored, art) {
+			result.Unchanged = append(result.Unchanged, art.ID)
+			continue
+		}
+		update := bson.M{
+			"$set":         art,
+			"$setOnInsert": bson.M{"ingested": now},
+		}
+		model := mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"id": art.ID}).
+			SetUpdate(update).
+			SetUpsert(true)
+		models = append(models, model)
+		writes = append(writes, art)
+	}
+	if len(models) == 0 {
+		return result, nil
 	}
 
-	err = result.createIndexes()
+	opts := options.BulkWrite().SetOrdered(false)
+	_, err = c.BulkWrite(ctx, models, opts)
+	failed := map[int]bool{}
+	var insertErrs storage.InsertErrors
 	if err != nil {
-		return nil, errors.Wrap(err, "createIndexes()")
+		bwe, ok := err.(mongo.BulkWriteException)
+		if !ok {
+			return result, errors.Wrap(err, "bulk write articles")
+		}
+		for _, we := range bwe.WriteErrors {
+			failed[we.Index] = true
+			insertErrs = append(insertErrs, storage.ArticleError{
+				GUID:    writes[we.Index].GUID,
+				Message: we.Message,
+			})
+		}
+		if bwe.WriteConcernError != nil {
+			return result, errors.Wrap(err, "bulk write articles")
+		}
+	}
+
+	for i, art := range writes {
+		if failed[i] {
+			continue
+		}
+		if _, ok := existing[art.ID]; ok {
+			result.Modified = append(result.Modified, art.ID)
+		} else {
+			result.Inserted = append(result.Inserted, art.ID)
+		}
 	}
 
-	return &result, nil
+	if len(insertErrs) > 0 {
+		return result, insertErrs
+	}
+	return result, nil
 }
 
-// InsertArticles inserts a collection of articles into the article collection
-func (pr *ArticleRepository) InsertArticles(ctx context.Context, articles []storage.Article) ([]string, error) {
-	c := pr.database.Collection(collectionArticles)
-	if c == nil {
-		return nil, fmt.Errorf("unable to get collection handler for %s", collectionArticles)
+// existingArticles returns the stored versions of `articles`, keyed by ID
+func (pr *ArticleRepository) existingArticles(ctx context.Context, c *mongo.Collection, articles []storage.Article) (map[string]storage.Article, error) {
+	ids := make([]string, 0, len(articles))
+	for _, art := range articles {
+		ids = append(ids, art.ID)
+	}
+	crs, err := c.Find(ctx, bson.M{"id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, errors.Wrap(err, "execute find query")
+	}
+	var stored []storage.Article
+	err = crs.All(ctx, &stored)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode all results")
+	}
+
+	result := make(map[string]storage.Article, len(stored))
+	for _, s := range stored {
+		result[s.ID] = s
 	}
+	return result, nil
+}
 
+// uniqueArticles drops all but the last of any articles with the same ID, which would otherwise race to be upserted.
+// IDs that aren't set are derived from the provider and GUID.
+func uniqueArticles(articles []storage.Article) []storage.Article {
+	index := map[string]int{}
+	var result []storage.Article
 	for _, art := range articles {
-		filter := &bson.M{
-			"guid": art.GUID,
+		if art.ID == "" {
+			art.ID = storage.ArticleID(art.ProviderID, art.GUID)
 		}
-		updateOpts := &options.UpdateOptions{
-			Upsert: &[]bool{true}[0],
+		if i, ok := index[art.ID]; ok {
+			result[i] = art
+			continue
 		}
-		update := bson.M{
-			"$set": art,
+		index[art.ID] = len(result)
+		result = append(result, art)
+	}
+	return result
+}
+
+// sameArticle reports whether the stored article `stored` already holds `art`. Mongo stores times to the millisecond.
+// Ingested isn't compared, as it's set by the repository.
+func sameArticle(stored, art storage.Article) bool {
+	sameTime := func(a, b time.Time) bool {
+		return a.Equal(b.Truncate(time.Millisecond))
+	}
+	sameStrings := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
 		}
-		_, err := c.UpdateOne(ctx, filter, update, updateOpts)
-		if err != nil {
-			return nil, errors.Wrap(err, "insert one document")
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
 		}
+		return true
 	}
+	return stored.ID == art.ID &&
+		stored.ProviderID == art.ProviderID &&
+		stored.Title == art.Title &&
+		stored.Link == art.Link &&
+		stored.Description == art.Description &&
+		stored.Content == art.Content &&
+		stored.Author == art.Author &&
+		sameTime(stored.Published, art.Published) &&
+		sameTime(stored.Updated, art.Updated) &&
+		stored.Thumbnail == art.Thumbnail &&
+		sameStrings(stored.Categories, art.Categories) &&
+		stored.Provider == art.Provider
+}
 
-	return nil, nil
+// GetArticle returns the article related to `articleID`. `storage.ErrNotFound` is returned if there's no such article.
+func (pr *ArticleRepository) GetArticle(ctx context.Context, articleID string) (storage.Article, error) {
+	coll := pr.database.Collection(collectionArticles)
+	if coll == nil {
+		return storage.Article{}, fmt.Errorf("unable to get collection handler for %s", collectionArticles)
+	}
+
+	var result storage.Article
+	err := coll.FindOne(ctx, bson.M{"id": articleID}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return storage.Article{}, storage.ErrNotFound{
+			Message: fmt.Sprintf("No article found for ID `%s`", articleID),
+		}
+	}
+	if err != nil {
+		return storage.Article{}, errors.Wrap(err, "execute find query")
+	}
+
+	return result, nil
 }
 
-// GetArticles returns a collection of article
-func (pr *ArticleRepository) GetArticles(ctx context.Context, offset, count int, categories, providers []string) ([]storage.Article, error) {
+// ExpiredArticles returns the articles selected by `query`, oldest ingested first
+func (pr *ArticleRepository) ExpiredArticles(ctx context.Context, query storage.ExpiryQuery) ([]storage.Article, error) {
+	filter := bson.M{"ingested": bson.M{"$lt": query.Before}}
+	providerID := bson.M{}
+	if len(query.ProviderIDs) > 0 {
+		providerID["$in"] = query.ProviderIDs
+	}
+	if len(query.ExcludeProviderIDs) > 0 {
+		providerID["$nin"] = query.ExcludeProviderIDs
+	}
+	if len(providerID) > 0 {
+		filter["providerid"] = providerID
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "ingested", Value: 1}, {Key: "id", Value: 1}})
+	if query.Count > 0 {
+		opts.SetLimit(int64(query.Count))
+	}
+	crs, err := pr.database.Collection(collectionArticles).Find(ctx, filter, opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "execute find query")
+	}
+	var results []storage.Article
+	err = crs.All(ctx, &results)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode all results")
+	}
+	return results, nil
+}
+
+// DeleteArticles deletes the articles related to `articleIDs`, returning how many were deleted
+func (pr *ArticleRepository) DeleteArticles(ctx context.Context, articleIDs []string) (int, error) {
+	if len(articleIDs) == 0 {
+		return 0, nil
+	}
+	res, err := pr.database.Collection(collectionArticles).DeleteMany(ctx, bson.M{"id": bson.M{"$in": articleIDs}})
+	if err != nil {
+		return 0, errors.Wrap(err, "delete articles")
+	}
+	return int(res.DeletedCount), nil
+}
+
+// GetArticles returns a page of articles in the query's order. Pages follow the query's cursor if it's set, otherwise
+// they're skipped by offset.
+func (pr *ArticleRepository) GetArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error) {
 	var results []storage.Article
 
+	err := query.Validate()
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+
 	coll := pr.database.Collection(collectionArticles)
 	if coll == nil {
-		return nil, fmt.Errorf("unable to get collection handler for %s", collectionArticles)
+		return storage.ArticlePage{}, fmt.Errorf("unable to get collection handler for %s", collectionArticles)
 	}
 
-	// A very rudimentary form of query composition - A hack based on how Mongo treats "empty" slices.
-	filter := bson.M{}
-	if len(categories) > 0 || len(providers) > 0 {
-		filter["$and"] = []bson.M{}
-		if len(categories) > 0 {
-			andCategories := bson.M{
-				"categories": bson.M{"$in": categories},
-			}
-			filter["$and"] = append(filter["$and"].([]bson.M), andCategories)
+	and := filterArticles(query.Categories, query.Providers)
+	published := bson.M{}
+	if !query.Since.IsZero() {
+		published["$gte"] = query.Since
+	}
+	if !query.Until.IsZero() {
+		published["$lt"] = query.Until
+	}
+	if len(published) > 0 {
+		and = append(and, bson.M{"published": published})
+	}
+
+	sortKey := query.SortField()
+	direction, compare := 1, "$gt"
+	if query.Descending() {
+		direction, compare = -1, "$lt" // -1 is descening (newest first)
+	}
+
+	options := options.Find().SetLimit(int64(query.Limit()))
+	if query.Cursor != "" {
+		cursor, err := storage.DecodeCursor(query)
+		if err != nil {
+			return storage.ArticlePage{}, err
 		}
-		if len(providers) > 0 {
-			andProvider := bson.M{
-				"provider": bson.M{"$in": providers},
-			}
-			filter["$and"] = append(filter["$and"].([]bson.M), andProvider)
+		var value interface{} = cursor.Time
+		if sortKey == storage.SortTitle {
+			value = cursor.Title
 		}
+		// Keyset pagination, so the page starts after the cursor regardless of what's been inserted since
+		and = append(and, bson.M{
+			"$or": []bson.M{
+				{sortKey: bson.M{compare: value}},
+				{sortKey: value, "id": bson.M{compare: cursor.ID}},
+			},
+		})
+	} else {
+		options.SetSkip(int64(query.Offset * query.Count))
 	}
-	options := options.Find().SetSkip(int64(offset * count)).SetLimit(int64(count))
-	sort := bson.M{
-		"published": -1, // -1 is descening (newest first)
+
+	if len(query.Fields) > 0 {
+		// The ID and sort field are needed for the next cursor
+		projection := bson.M{"id": 1, sortKey: 1}
+		for _, field := range query.Fields {
+			projection[strings.ToLower(field)] = 1
+		}
+		options.SetProjection(projection)
+	}
+
+	filter := bson.M{}
+	if len(and) > 0 {
+		filter["$and"] = and
+	}
+	sort := bson.D{
+		{Key: sortKey, Value: direction},
+		{Key: "id", Value: direction},
 	}
 	options.SetSort(sort)
 	crs, err := coll.Find(ctx, filter, options)
+	if err != nil {
+		return storage.ArticlePage{}, errors.Wrap(err, "execute find query")
+	}
+	err = crs.All(ctx, &results)
+	if err != nil {
+		return storage.ArticlePage{}, errors.Wrap(err, "decode all results")
+	}
+
+	return storage.NewArticlePage(results, query), nil
+}
+
+// Search returns a page of articles whose title or description match the query's text, using the text index
+func (pr *ArticleRepository) Search(ctx context.Context, query storage.SearchQuery) ([]storage.Article, error) {
+	var results []storage.Article
+
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	coll := pr.database.Collection(collectionArticles)
+	if coll == nil {
+		return nil, fmt.Errorf("unable to get collection handler for %s", collectionArticles)
+	}
+
+	and := append([]bson.M{
+		{"$text": bson.M{"$search": query.Text}},
+	}, filterArticles(query.Categories, query.Providers)...)
+	filter := bson.M{
+		"$and": and,
+	}
+
+	score := bson.M{"$meta": "textScore"}
+	sort := bson.D{
+		{Key: "published", Value: -1},
+		{Key: "id", Value: -1},
+	}
+	if query.Rank == storage.RankRelevance {
+		sort = append(bson.D{{Key: "score", Value: score}}, sort...)
+	}
+	options := options.Find().
+		SetProjection(bson.M{"score": score}).
+		SetSort(sort).
+		SetSkip(int64(query.Offset * query.Count)).
+		SetLimit(int64(query.Count))
+	crs, err := coll.Find(ctx, filter, options)
 	if err != nil {
 		return nil, errors.Wrap(err, "execute find query")
 	}
@@ -116,18 +379,21 @@ func (pr *ArticleRepository) GetArticles(ctx context.Context, offset, count int,
 
 	return results, nil
 }
-func (pr *ArticleRepository) createIndexes() error {
-	// Bootstrap the Mongo DB repo here. This is very much an afterthought and needs its own home and improving.
-	models := mongo.IndexModel{
-		Keys:    bson.D{{Key: "guid", Value: 1}},
-		Options: options.Index().SetName("guid").SetUnique(true),
-	}
-	opts := options.CreateIndexes().SetMaxTime(60 * time.Second)
-	_, err := pr.database.Collection(collectionArticles).Indexes().CreateOne(context.Background(), models, opts)
-	if err != nil {
-		return errors.Wrap(err, "create article GUID index")
-	}
 
-	log.Println("Created MongoDB indexes")
-	return nil
+// filterArticles returns the conditions for articles in any of `categories` and from any of `providers`. Empty filters
+// match every article.
+func filterArticles(categories, providers []string) []bson.M {
+	// A very rudimentary form of query composition - A hack based on how Mongo treats "empty" slices.
+	var and []bson.M
+	if len(categories) > 0 {
+		and = append(and, bson.M{
+			"categories": bson.M{"$in": categories},
+		})
+	}
+	if len(providers) > 0 {
+		and = append(and, bson.M{
+			"provider": bson.M{"$in": providers},
+		})
+	}
+	return and
 }
@@ -0,0 +1,132 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const collectionLeases = "leases"
+
+// LeaseRepository is an implementation to manage leases in MongoDB store
+type LeaseRepository struct {
+	database *mongo.Database
+}
+
+// lease is the document stored for a lease, keyed by the lease name
+type lease struct {
+	Name    string    `bson:"_id"`
+	Owner   string    `bson:"owner"`
+	Expires time.Time `bson:"expires"`
+}
+
+// NewLeaseRepository returns a LeaseRepository using the database of `client`
+func NewLeaseRepository(client *Client) *LeaseRepository {
+	return &LeaseRepository{
+		database: client.database,
+	}
+}
+
+// AcquireLease takes or extends the lease `name` for `owner`
+func (lr *LeaseRepository) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	c := lr.database.Collection(collectionLeases)
+	if c == nil {
+		return false, fmt.Errorf("unable to get collection handler for %s", collectionLeases)
+	}
+
+	now := time.Now()
+	// Matches the lease if it's ours or has expired. If it's held by someone else nothing matches, so the upsert tries to
+	// insert a second document with the same _id and fails with a duplicate key error.
+	filter := bson.M{
+		"_id": name,
+		"$or": []bson.M{
+			{"owner": owner},
+			{"expires": bson.M{"$lt": now}},
+		},
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"owner":   owner,
+			"expires": now.Add(ttl),
+		},
+	}
+	_, err := c.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if err != nil {
+		if isDuplicateKey(err) {
+			return false, nil
+		}
+		return false, errors.Wrap(err, "upsert lease")
+	}
+
+	return true, nil
+}
+
+// ReleaseLease deletes the lease `name` if it's held by `owner`
+func (lr *LeaseRepository) ReleaseLease(ctx context.Context, name, owner string) error {
+	c := lr.database.Collection(collectionLeases)
+	if c == nil {
+		return fmt.Errorf("unable to get collection handler for %s", collectionLeases)
+	}
+
+	_, err := c.DeleteOne(ctx, bson.M{"_id": name, "owner": owner})
+	if err != nil {
+		return errors.Wrap(err, "delete lease")
+	}
+
+	return nil
+}
+
+// GetLeases returns the unexpired leases with names beginning with `prefix`
+func (lr *LeaseRepository) GetLeases(ctx context.Context, prefix string) ([]storage.Lease, error) {
+	c := lr.database.Collection(collectionLeases)
+	if c == nil {
+		return nil, fmt.Errorf("unable to get collection handler for %s", collectionLeases)
+	}
+
+	filter := bson.M{
+		"_id":     bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)},
+		"expires": bson.M{"$gte": time.Now()},
+	}
+	crs, err := c.Find(ctx, filter)
+	if err != nil {
+		return nil, errors.Wrap(err, "execute find query")
+	}
+	var docs []lease
+	err = crs.All(ctx, &docs)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode all results")
+	}
+
+	result := make([]storage.Lease, 0, len(docs))
+	for _, d := range docs {
+		result = append(result, storage.Lease{
+			Name:    d.Name,
+			Owner:   d.Owner,
+			Expires: d.Expires,
+		})
+	}
+	return result, nil
+}
+
+// isDuplicateKey reports whether `err` is caused by a unique index violation
+func isDuplicateKey(err error) bool {
+	const duplicateKey = 11000
+	switch e := errors.Cause(err).(type) {
+	case mongo.WriteException:
+		for _, we := range e.WriteErrors {
+			if we.Code == duplicateKey {
+				return true
+			}
+		}
+	case mongo.CommandError:
+		return e.Code == duplicateKey
+	}
+	return false
+}
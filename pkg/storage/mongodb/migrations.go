@@ -0,0 +1,367 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/chackett/zignews/pkg/schedule"
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	collectionMigrations = "migrations"
+	// migrationLease is held while migrating, so migrations aren't run twice at once
+	migrationLease    = "migrations"
+	migrationLeaseTTL = 30 * time.Minute
+	// backfillBatchSize is the number of documents updated by each bulk write when backfilling
+	backfillBatchSize = 500
+	// indexNotFound is the code of the error dropping an index that doesn't exist
+	indexNotFound = 27
+)
+
+// Migration is a versioned change to the database. Migrations are applied in order and never changed once released,
+// new ones are appended. Each can be run again if it fails part way.
+type Migration struct {
+	Version     int
+	Description string
+	// Applied is when the migration was applied, zero if it hasn't been
+	Applied time.Time
+	up      func(ctx context.Context, db *mongo.Database) error
+}
+
+// appliedMigration is the document recorded for each migration applied
+type appliedMigration struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	Applied     time.Time `bson:"applied"`
+}
+
+var migrations = []Migration{
+	{Version: 1, Description: "create article indexes", up: createArticleIndexes},
+	{Version: 2, Description: "bootstrap providers", up: bootstrapProviders},
+	{Version: 3, Description: "backfill article ids and ingested times", up: backfillArticles},
+	{Version: 4, Description: "require article ids", up: requireArticleIDs},
+	{Version: 5, Description: "bring provider poll frequencies within limits", up: fixPollFrequencies},
+	{Version: 6, Description: "create article ingested index", up: createIngestedIndex},
+	{Version: 7, Description: "key articles by provider and guid", up: keyArticlesByProvider},
+}
+
+// Migrations returns every migration, with when it was applied to the database of `client`
+func Migrations(ctx context.Context, client *Client) ([]Migration, error) {
+	cur, err := client.database.Collection(collectionMigrations).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "find applied migrations")
+	}
+	var applied []appliedMigration
+	err = cur.All(ctx, &applied)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode applied migrations")
+	}
+	appliedAt := map[int]time.Time{}
+	for _, a := range applied {
+		appliedAt[a.Version] = a.Applied
+	}
+
+	result := make([]Migration, len(migrations))
+	for i, m := range migrations {
+		m.Applied = appliedAt[m.Version]
+		result[i] = m
+	}
+	return result, nil
+}
+
+// Migrate applies the migrations that haven't been applied to the database of `client`, in order, returning those it
+// applied. It stops at the first that fails.
+func Migrate(ctx context.Context, client *Client) ([]Migration, error) {
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	leases := NewLeaseRepository(client)
+	held, err := leases.AcquireLease(ctx, migrationLease, owner, migrationLeaseTTL)
+	if err != nil {
+		return nil, errors.Wrap(err, "acquire migration lease")
+	}
+	if !held {
+		return nil, errors.New("migrations are already being applied")
+	}
+	defer func() {
+		err := leases.ReleaseLease(context.Background(), migrationLease, owner)
+		if err != nil {
+			log.Printf("ERROR: Release migration lease - %s", err.Error())
+		}
+	}()
+
+	all, err := Migrations(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, m := range all {
+		if !m.Applied.IsZero() {
+			continue
+		}
+		log.Printf("Applying migration %d - %s", m.Version, m.Description)
+		err = m.up(ctx, client.database)
+		if err != nil {
+			return applied, errors.Wrapf(err, "migration %d", m.Version)
+		}
+		m.Applied = time.Now()
+		_, err = client.database.Collection(collectionMigrations).InsertOne(ctx, appliedMigration{
+			Version:     m.Version,
+			Description: m.Description,
+			Applied:     m.Applied,
+		})
+		if err != nil {
+			return applied, errors.Wrapf(err, "record migration %d", m.Version)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// PendingMigrations returns how many migrations haven't been applied to the database of `client`
+func PendingMigrations(ctx context.Context, client *Client) (int, error) {
+	all, err := Migrations(ctx, client)
+	if err != nil {
+		return 0, err
+	}
+	pending := 0
+	for _, m := range all {
+		if m.Applied.IsZero() {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+func createArticleIndexes(ctx context.Context, db *mongo.Database) error {
+	models := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "guid", Value: 1}},
+			Options: options.Index().SetName("guid").SetUnique(true),
+		},
+		{
+			// Sparse, as articles stored before they had IDs don't get one until they're backfilled
+			Keys:    bson.D{{Key: "id", Value: 1}},
+			Options: options.Index().SetName("id").SetUnique(true).SetSparse(true),
+		},
+		{
+			// Used by Search. Matches in the title count for more.
+			Keys:    bson.D{{Key: "title", Value: "text"}, {Key: "description", Value: "text"}},
+			Options: options.Index().SetName("text").SetWeights(bson.M{"title": 3, "description": 1}),
+		},
+	}
+	opts := options.CreateIndexes().SetMaxTime(60 * time.Second)
+	_, err := db.Collection(collectionArticles).Indexes().CreateMany(ctx, models, opts)
+	if err != nil {
+		return errors.Wrap(err, "create article indexes")
+	}
+	return nil
+}
+
+// bootstrapProviders inserts the default providers if there aren't any, so a new database has news to aggregate
+func bootstrapProviders(ctx context.Context, db *mongo.Database) error {
+	c := db.Collection(collectionProviders)
+	count, err := c.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		return errors.Wrap(err, "count providers")
+	}
+	if count > 0 {
+		log.Print("Skipping bootstrap providers as providers already exist.")
+		return nil
+	}
+
+	var docs []interface{}
+	for _, p := range storage.DefaultProviders() {
+		// Bootstrap providers are held to the same limits as providers saved through the api
+		err = p.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "validate bootstrap provider `%s`", p.Label)
+		}
+		docs = append(docs, p)
+	}
+	_, err = c.InsertMany(ctx, docs)
+	if err != nil {
+		return errors.Wrap(err, "insert bootstrap providers")
+	}
+	return nil
+}
+
+// backfillArticles gives articles stored before articles had IDs or ingested times their values. The provider ID is
+// looked up by label for articles stored before that was recorded too, and ingested times are taken from the time
+// the document was created.
+func backfillArticles(ctx context.Context, db *mongo.Database) error {
+	providerIDs, err := providerIDsByLabel(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	c := db.Collection(collectionArticles)
+	filter := bson.M{
+		"$or": []bson.M{
+			{"id": bson.M{"$in": []interface{}{nil, ""}}},
+			{"ingested": bson.M{"$exists": false}},
+		},
+	}
+	cur, err := c.Find(ctx, filter)
+	if err != nil {
+		return errors.Wrap(err, "find articles to backfill")
+	}
+	defer cur.Close(ctx)
+
+	var models []mongo.WriteModel
+	write := func() error {
+		if len(models) == 0 {
+			return nil
+		}
+		_, err := c.BulkWrite(ctx, models, options.BulkWrite().SetOrdered(false))
+		models = models[:0]
+		return errors.Wrap(err, "backfill articles")
+	}
+	for cur.Next(ctx) {
+		var doc struct {
+			ObjectID   primitive.ObjectID `bson:"_id"`
+			ID         string             `bson:"id"`
+			ProviderID string             `bson:"providerid"`
+			Provider   string             `bson:"provider"`
+			GUID       string             `bson:"guid"`
+			Ingested   time.Time          `bson:"ingested"`
+		}
+		err = cur.Decode(&doc)
+		if err != nil {
+			return errors.Wrap(err, "decode article")
+		}
+
+		set := bson.M{}
+		if doc.ID == "" {
+			if doc.ProviderID == "" {
+				doc.ProviderID = providerIDs[doc.Provider]
+				set["providerid"] = doc.ProviderID
+			}
+			set["id"] = storage.ArticleID(doc.ProviderID, doc.GUID)
+		}
+		if doc.Ingested.IsZero() {
+			set["ingested"] = doc.ObjectID.Timestamp()
+		}
+		models = append(models, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.ObjectID}).
+			SetUpdate(bson.M{"$set": set}))
+		if len(models) == backfillBatchSize {
+			err = write()
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return errors.Wrap(err, "read articles to backfill")
+	}
+	return write()
+}
+
+func providerIDsByLabel(ctx context.Context, db *mongo.Database) (map[string]string, error) {
+	cur, err := db.Collection(collectionProviders).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, errors.Wrap(err, "find providers")
+	}
+	var providers []storage.Provider
+	err = cur.All(ctx, &providers)
+	if err != nil {
+		return nil, errors.Wrap(err, "decode providers")
+	}
+	result := map[string]string{}
+	for _, p := range providers {
+		result[p.Label] = p.ID
+	}
+	return result, nil
+}
+
+// requireArticleIDs replaces the sparse article ID index, now every article has an ID
+func requireArticleIDs(ctx context.Context, db *mongo.Database) error {
+	indexes := db.Collection(collectionArticles).Indexes()
+	_, err := indexes.DropOne(ctx, "id")
+	if e, ok := errors.Cause(err).(mongo.CommandError); ok && e.Code == indexNotFound {
+		err = nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "drop sparse id index")
+	}
+	_, err = indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetName("id").SetUnique(true),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create id index")
+	}
+	return nil
+}
+
+// fixPollFrequencies brings the poll frequencies of providers saved before they were validated within the limits, so
+// they can run. Providers without a frequency get the default. Providers polled on a cron schedule don't use it.
+func fixPollFrequencies(ctx context.Context, db *mongo.Database) error {
+	const defaultPollFrequencySeconds = 300
+	min, max := int(schedule.MinPollFrequency/time.Second), int(schedule.MaxPollFrequency/time.Second)
+	noSchedule := bson.M{"$in": []interface{}{nil, ""}}
+	fixes := []struct {
+		frequency bson.M
+		value     int
+	}{
+		{bson.M{"$in": []interface{}{nil, 0}}, defaultPollFrequencySeconds},
+		{bson.M{"$gt": 0, "$lt": min}, min},
+		{bson.M{"$gt": max}, max},
+	}
+	c := db.Collection(collectionProviders)
+	for _, fix := range fixes {
+		res, err := c.UpdateMany(ctx,
+			bson.M{"schedule": noSchedule, "pollfrequencyseconds": fix.frequency},
+			bson.M{"$set": bson.M{"pollfrequencyseconds": fix.value}},
+		)
+		if err != nil {
+			return errors.Wrap(err, "update poll frequencies")
+		}
+		if res.ModifiedCount > 0 {
+			log.Printf("Set the poll frequency of %d providers to %ds", res.ModifiedCount, fix.value)
+		}
+	}
+	return nil
+}
+
+// createIngestedIndex indexes articles by when they were ingested, for finding those a retention policy has expired
+func createIngestedIndex(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection(collectionArticles).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "ingested", Value: 1}, {Key: "id", Value: 1}},
+		Options: options.Index().SetName("ingested"),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create ingested index")
+	}
+	return nil
+}
+
+// keyArticlesByProvider replaces the unique GUID index with one on the provider and GUID, as providers can share GUIDs.
+// Articles are upserted by ID, which is derived from both.
+func keyArticlesByProvider(ctx context.Context, db *mongo.Database) error {
+	indexes := db.Collection(collectionArticles).Indexes()
+	_, err := indexes.CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "providerid", Value: 1}, {Key: "guid", Value: 1}},
+		Options: options.Index().SetName("provider_guid").SetUnique(true),
+	})
+	if err != nil {
+		return errors.Wrap(err, "create provider guid index")
+	}
+	_, err = indexes.DropOne(ctx, "guid")
+	if e, ok := errors.Cause(err).(mongo.CommandError); ok && e.Code == indexNotFound {
+		err = nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "drop guid index")
+	}
+	return nil
+}
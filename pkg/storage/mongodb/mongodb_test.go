@@ -0,0 +1,80 @@
+package mongodb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/chackett/zignews/pkg/storage/storagetest"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// The conformance tests need a MongoDB server, e.g. `docker-compose up db`. They're skipped unless MG_TEST_ADDR is
+// set. Each test uses its own database, which is dropped afterwards.
+
+func requireMongo(t *testing.T) {
+	if os.Getenv("MG_TEST_ADDR") == "" {
+		t.Skip("MG_TEST_ADDR isn't set")
+	}
+}
+
+// testClient connects to a new, migrated test database, which is dropped once the test is done
+func testClient(t *testing.T) *Client {
+	user, pass := os.Getenv("MG_TEST_USER"), os.Getenv("MG_TEST_PASS")
+	if user == "" {
+		user, pass = "root", "password"
+	}
+	client, err := Connect(Config{
+		Hosts:    []string{os.Getenv("MG_TEST_ADDR")},
+		User:     user,
+		Password: pass,
+		Database: fmt.Sprintf("zignews_test_%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx := context.Background()
+		err := client.database.Drop(ctx)
+		if err != nil {
+			t.Errorf("drop test database - %v", err)
+		}
+		_ = client.Disconnect(ctx)
+	})
+
+	_, err = Migrate(context.Background(), client)
+	if err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return client
+}
+
+func TestArticleRepository(t *testing.T) {
+	requireMongo(t)
+	storagetest.TestArticleRepository(t, func(t *testing.T) storage.ArticleRepository {
+		return NewArticleRepository(testClient(t))
+	})
+}
+
+func TestProviderRepository(t *testing.T) {
+	requireMongo(t)
+	storagetest.TestProviderRepository(t, func(t *testing.T) storage.ProviderRepository {
+		client := testClient(t)
+		// The tests need an empty repository, not the bootstrapped providers
+		_, err := client.database.Collection(collectionProviders).DeleteMany(context.Background(), bson.M{})
+		if err != nil {
+			t.Fatalf("delete bootstrapped providers - %v", err)
+		}
+		return NewProviderRepository(client)
+	})
+}
+
+func TestLeaseRepository(t *testing.T) {
+	requireMongo(t)
+	storagetest.TestLeaseRepository(t, func(t *testing.T) storage.LeaseRepository {
+		return NewLeaseRepository(testClient(t))
+	})
+}
@@ -3,7 +3,6 @@ package mongodb
 import (
 	"context"
 	"fmt"
-	"log"
 
 	"github.com/chackett/zignews/pkg/storage"
 	"github.com/pkg/errors"
@@ -17,32 +16,14 @@ const collectionProviders = "providers"
 
 // ProviderRepository is an implementation to create/retrieve providers from MongoBD store
 type ProviderRepository struct {
-	client   *mongo.Client
 	database *mongo.Database
 }
 
-// NewProviderRepository ..
-func NewProviderRepository(connection, user, password, dbName string) (*ProviderRepository, error) {
-	URI := fmt.Sprintf("mongodb://%s:%s@%s", user, password, connection)
-	_client, err := mongo.NewClient(options.Client().ApplyURI(URI))
-	if err != nil {
-		return nil, errors.Wrap(err, "mongo.NewClient()")
-	}
-	err = _client.Connect(context.Background())
-	if err != nil {
-		return nil, errors.Wrap(err, "mongo client.Connect()")
-	}
-
-	_database := _client.Database(dbName)
-
-	result := &ProviderRepository{
-		client:   _client,
-		database: _database,
+// NewProviderRepository returns a ProviderRepository using the database of `client`, which must have been migrated
+func NewProviderRepository(client *Client) *ProviderRepository {
+	return &ProviderRepository{
+		database: client.database,
 	}
-
-	result.bootStrapProviders()
-
-	return result, nil
 }
 
 // InsertProviders inserts a provider into the provider collection
@@ -91,59 +72,17 @@ func (pr *ProviderRepository) GetProviders(ctx context.Context, offset, count in
 	return results, nil
 }
 
-func (pr *ProviderRepository) bootStrapProviders() error {
-	existing, err := pr.GetProviders(context.Background(), 0, 9999)
-	if err != nil {
-		return errors.Wrap(err, "get providers")
-	}
-	if len(existing) > 0 {
-		log.Print("Skipping bootstrap providers as providers already exist.")
-		return nil
-	}
-	providers := []storage.Provider{
-		{
-			Type:                 "rss",
-			FeedURL:              "http://feeds.bbci.co.uk/news/uk/rss.xml",
-			Label:                "BBC News UK",
-			PollFrequencySeconds: 0,
-		},
-		{
-			Type:                 "rss",
-			FeedURL:              "http://feeds.bbci.co.uk/news/technology/rss.xml",
-			Label:                "BBC News Technology",
-			PollFrequencySeconds: 1,
-		},
-		{
-			Type:                 "rss",
-			FeedURL:              "http://feeds.skynews.com/feeds/rss/uk.xml",
-			Label:                "Sky News UK",
-			PollFrequencySeconds: 2,
-		},
-		{
-			Type:                 "rss",
-			FeedURL:              "http://feeds.skynews.com/feeds/rss/technology.xml",
-			Label:                "Sky News Technology",
-			PollFrequencySeconds: 3,
-		},
-	}
-	_, err = pr.InsertProviders(context.Background(), providers)
-	if err != nil {
-		log.Fatal(errors.Wrap(err, "bootstrap providers"))
-	}
-	log.Print("Successfully bootstrapped provider list")
-	return nil
-}
-
-// GetProvider returns the provider related to the specified `providerID`. Use `IsNotFound()` to determine if item was not found.
+// GetProvider returns the provider related to the specified `providerID`. `storage.ErrNotFound` is returned if there's no
+// such provider.
 func (pr *ProviderRepository) GetProvider(ctx context.Context, providerID string) (storage.Provider, error) {
 	coll := pr.database.Collection(collectionProviders)
 	if coll == nil {
 		return storage.Provider{}, fmt.Errorf("unable to get collection handler for %s", collectionProviders)
 	}
 
-	objID, err := primitive.ObjectIDFromHex(providerID)
+	objID, err := providerObjectID(providerID)
 	if err != nil {
-		return storage.Provider{}, errors.Wrap(err, "ObjectIDFromHex()")
+		return storage.Provider{}, err
 	}
 
 	filter := bson.M{
@@ -152,16 +91,11 @@ func (pr *ProviderRepository) GetProvider(ctx context.Context, providerID string
 	options := options.FindOne()
 	mgResult := coll.FindOne(ctx, filter, options)
 	err = mgResult.Err()
-	if err != nil {
-		return storage.Provider{}, errors.Wrap(err, "execute find query")
-	}
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
-			return storage.Provider{}, storage.ErrNotFound{
-				Message: fmt.Sprintf("No provider found for ID `%s`", providerID),
-			}
+			return storage.Provider{}, providerNotFound(providerID)
 		}
-		return storage.Provider{}, errors.Wrap(err, "execute query")
+		return storage.Provider{}, errors.Wrap(err, "execute find query")
 	}
 
 	var result storage.Provider
@@ -172,3 +106,134 @@ func (pr *ProviderRepository) GetProvider(ctx context.Context, providerID string
 
 	return result, nil
 }
+
+// UpdateProvider replaces the configuration of the provider related to `provider.ID`, resetting its fetch state and
+// poll status. `storage.ErrNotFound` is returned if there's no such provider.
+func (pr *ProviderRepository) UpdateProvider(ctx context.Context, provider storage.Provider) error {
+	coll := pr.database.Collection(collectionProviders)
+	if coll == nil {
+		return fmt.Errorf("unable to get collection handler for %s", collectionProviders)
+	}
+
+	objID, err := providerObjectID(provider.ID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id": objID,
+	}
+	update := bson.M{
+		"$set": bson.M{
+			"type":                    provider.Type,
+			"label":                   provider.Label,
+			"feedurl":                 provider.FeedURL,
+			"pollfrequencyseconds":    provider.PollFrequencySeconds,
+			"schedule":                provider.Schedule,
+			"quiethours":              provider.QuietHours,
+			"timezone":                provider.Timezone,
+			"adaptive":                provider.Adaptive,
+			"minpollfrequencyseconds": provider.MinPollFrequencySeconds,
+			"maxpollfrequencyseconds": provider.MaxPollFrequencySeconds,
+			"retentiondays":           provider.RetentionDays,
+		},
+		"$unset": bson.M{
+			"fetchstate":                  "",
+			"learnedpollfrequencyseconds": "",
+			"status":                      "",
+		},
+	}
+	res, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Wrap(err, "update one document")
+	}
+	if res.MatchedCount == 0 {
+		return providerNotFound(provider.ID)
+	}
+
+	return nil
+}
+
+// DeleteProvider deletes the provider related to the specified `providerID`. `storage.ErrNotFound` is returned if
+// there's no such provider.
+func (pr *ProviderRepository) DeleteProvider(ctx context.Context, providerID string) error {
+	coll := pr.database.Collection(collectionProviders)
+	if coll == nil {
+		return fmt.Errorf("unable to get collection handler for %s", collectionProviders)
+	}
+
+	objID, err := providerObjectID(providerID)
+	if err != nil {
+		return err
+	}
+
+	res, err := coll.DeleteOne(ctx, bson.M{"_id": objID})
+	if err != nil {
+		return errors.Wrap(err, "delete one document")
+	}
+	if res.DeletedCount == 0 {
+		return providerNotFound(providerID)
+	}
+
+	return nil
+}
+
+// UpdateFetchState replaces the fetch state of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdateFetchState(ctx context.Context, providerID string, state storage.FetchState) error {
+	return pr.setFields(ctx, providerID, bson.M{"fetchstate": state})
+}
+
+// UpdatePollStatus replaces the poll status of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdatePollStatus(ctx context.Context, providerID string, status storage.PollStatus) error {
+	return pr.setFields(ctx, providerID, bson.M{"status": status})
+}
+
+// UpdateLearnedPollFrequency records the poll frequency learned by adaptive polling of the provider related to the
+// specified `providerID`
+func (pr *ProviderRepository) UpdateLearnedPollFrequency(ctx context.Context, providerID string, seconds int) error {
+	return pr.setFields(ctx, providerID, bson.M{"learnedpollfrequencyseconds": seconds})
+}
+
+// setFields `$set`s fields on a single provider document. `storage.ErrNotFound` is returned if there's no such provider.
+func (pr *ProviderRepository) setFields(ctx context.Context, providerID string, fields bson.M) error {
+	coll := pr.database.Collection(collectionProviders)
+	if coll == nil {
+		return fmt.Errorf("unable to get collection handler for %s", collectionProviders)
+	}
+
+	objID, err := providerObjectID(providerID)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{
+		"_id": objID,
+	}
+	update := bson.M{
+		"$set": fields,
+	}
+	res, err := coll.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return errors.Wrap(err, "update one document")
+	}
+	if res.MatchedCount == 0 {
+		return providerNotFound(providerID)
+	}
+
+	return nil
+}
+
+// providerObjectID parses a provider ID. An ID that isn't a valid ObjectID can't match a provider, so it's not found.
+func providerObjectID(providerID string) (primitive.ObjectID, error) {
+	objID, err := primitive.ObjectIDFromHex(providerID)
+	if err != nil {
+		return primitive.NilObjectID, providerNotFound(providerID)
+	}
+	return objID, nil
+}
+
+func providerNotFound(providerID string) error {
+	return storage.ErrNotFound{
+		Message: fmt.Sprintf("No provider found for ID `%s`", providerID),
+	}
+}
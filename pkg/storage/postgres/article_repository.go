@@ -0,0 +1,417 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// searchVector is the document articles are searched in. Matches in the title are weighted above the description.
+const searchVector = `setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', description), 'D')`
+
+// insertBatchSize limits the rows upserted by a statement, keeping within the limit of parameters
+const insertBatchSize = 500
+
+// articleColumn is the column holding an article field
+type articleColumn struct {
+	name string
+	dest func(a *storage.Article) interface{}
+}
+
+// articleColumns map article field names to their columns, in the order articles are inserted
+var articleColumns = []struct {
+	field string
+	articleColumn
+}{
+	{"id", articleColumn{"id", func(a *storage.Article) interface{} { return &a.ID }}},
+	{"providerID", articleColumn{"provider_id", func(a *storage.Article) interface{} { return &a.ProviderID }}},
+	{"title", articleColumn{"title", func(a *storage.Article) interface{} { return &a.Title }}},
+	{"link", articleColumn{"link", func(a *storage.Article) interface{} { return &a.Link }}},
+	{"description", articleColumn{"description", func(a *storage.Article) interface{} { return &a.Description }}},
+	{"content", articleColumn{"content", func(a *storage.Article) interface{} { return &a.Content }}},
+	{"author", articleColumn{"author", func(a *storage.Article) interface{} { return &a.Author }}},
+	{"published", articleColumn{"published", func(a *storage.Article) interface{} { return &a.Published }}},
+	{"updated", articleColumn{"updated", func(a *storage.Article) interface{} { return &a.Updated }}},
+	{"guid", articleColumn{"guid", func(a *storage.Article) interface{} { return &a.GUID }}},
+	{"thumbnail", articleColumn{"thumbnail", func(a *storage.Article) interface{} { return &a.Thumbnail }}},
+	{"categories", articleColumn{"categories", func(a *storage.Article) interface{} { return pq.Array(&a.Categories) }}},
+	{"provider", articleColumn{"provider", func(a *storage.Article) interface{} { return &a.Provider }}},
+	// Ingested is set by the database, so it's last and isn't inserted
+	{"ingested", articleColumn{"ingested", func(a *storage.Article) interface{} { return &a.Ingested }}},
+}
+
+// ArticleRepository is an implementation to CRUD articles in PostgreSQL
+type ArticleRepository struct {
+	db *sql.DB
+}
+
+// NewArticleRepository returns an ArticleRepository using `db`, which must have been migrated
+func NewArticleRepository(db *sql.DB) *ArticleRepository {
+	return &ArticleRepository{
+		db: db,
+	}
+}
+
+// InsertArticles upserts articles by ID, reporting which were inserted, modified or unchanged. Articles are only
+// updated when they've changed, and keep the time they were first ingested.
+func (ar *ArticleRepository) InsertArticles(ctx context.Context, articles []storage.Article) (storage.InsertResult, error) {
+	var result storage.InsertResult
+	articles = uniqueArticles(articles)
+	for start := 0; start < len(articles); start += insertBatchSize {
+		end := start + insertBatchSize
+		if end > len(articles) {
+			end = len(articles)
+		}
+		err := ar.upsert(ctx, articles[start:end], &result)
+		if err != nil {
+			return result, errors.Wrap(err, "upsert articles")
+		}
+	}
+	return result, nil
+}
+
+// upsert upserts a batch of articles with unique IDs, adding them to `result`
+func (ar *ArticleRepository) upsert(ctx context.Context, articles []storage.Article, result *storage.InsertResult) error {
+	columns := insertColumns()
+	var args queryArgs
+	var values []string
+	for _, art := range articles {
+		placeholders := make([]string, len(columns))
+		for i, v := range insertValues(art) {
+			placeholders[i] = args.add(v)
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+
+	var set, stored, excluded []string
+	for _, c := range columns {
+		set = append(set, c+" = EXCLUDED."+c)
+		stored = append(stored, "articles."+c)
+		excluded = append(excluded, "EXCLUDED."+c)
+	}
+	// Unchanged articles aren't updated, so aren't returned. xmax is zero for rows that were inserted.
+	query := fmt.Sprintf(`
+		INSERT INTO articles (%s) VALUES %s
+		ON CONFLICT (id) DO UPDATE SET %s
+		WHERE (%s) IS DISTINCT FROM (%s)
+		RETURNING id, xmax = 0`,
+		strings.Join(columns, ", "), strings.Join(values, ", "), strings.Join(set, ", "),
+		strings.Join(stored, ", "), strings.Join(excluded, ", "))
+
+	rows, err := ar.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	inserted := map[string]bool{}
+	for rows.Next() {
+		var id string
+		var isInsert bool
+		err = rows.Scan(&id, &isInsert)
+		if err != nil {
+			return errors.Wrap(err, "scan upserted article")
+		}
+		inserted[id] = isInsert
+	}
+	if err := rows.Err(); err != nil {
+		return errors.Wrap(err, "read upserted articles")
+	}
+
+	for _, art := range articles {
+		isInsert, changed := inserted[art.ID]
+		switch {
+		case !changed:
+			result.Unchanged = append(result.Unchanged, art.ID)
+		case isInsert:
+			result.Inserted = append(result.Inserted, art.ID)
+		default:
+			result.Modified = append(result.Modified, art.ID)
+		}
+	}
+	return nil
+}
+
+// GetArticle returns the article related to `articleID`. `storage.ErrNotFound` is returned if there's no such article.
+func (ar *ArticleRepository) GetArticle(ctx context.Context, articleID string) (storage.Article, error) {
+	columns := selectColumns(nil)
+	row := ar.db.QueryRowContext(ctx, `SELECT `+columnNames(columns)+` FROM articles WHERE id = $1`, articleID)
+	art, err := scanArticle(row, columns)
+	if err == sql.ErrNoRows {
+		return storage.Article{}, storage.ErrNotFound{
+			Message: fmt.Sprintf("No article found for ID `%s`", articleID),
+		}
+	}
+	if err != nil {
+		return storage.Article{}, errors.Wrap(err, "get article")
+	}
+	return art, nil
+}
+
+// GetArticles returns a page of articles in the query's order. Pages follow the query's cursor if it's set, otherwise
+// they're skipped by offset.
+func (ar *ArticleRepository) GetArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error) {
+	err := query.Validate()
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+
+	var args queryArgs
+	conditions := filterArticles(&args, query.Categories, query.Providers)
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "published >= "+args.add(query.Since))
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "published < "+args.add(query.Until))
+	}
+
+	// Text is compared byte by byte, so the order doesn't depend on the database's collation
+	sortKey := query.SortField()
+	if sortKey == storage.SortTitle {
+		sortKey = `title COLLATE "C"`
+	}
+	direction, compare := "ASC", ">"
+	if query.Descending() {
+		direction, compare = "DESC", "<"
+	}
+
+	if query.Cursor != "" {
+		cursor, err := storage.DecodeCursor(query)
+		if err != nil {
+			return storage.ArticlePage{}, err
+		}
+		// Keyset pagination, so the page starts after the cursor regardless of what's been inserted since
+		var after interface{} = cursor.Time
+		if query.SortField() == storage.SortTitle {
+			after = cursor.Title
+		}
+		conditions = append(conditions, fmt.Sprintf(`(%s, id COLLATE "C") %s (%s, %s)`,
+			sortKey, compare, args.add(after), args.add(cursor.ID)))
+	}
+
+	var fields []string
+	if len(query.Fields) > 0 {
+		// The sort field is needed for the next cursor
+		fields = append([]string{query.SortField()}, query.Fields...)
+	}
+	columns := selectColumns(fields)
+	statement := `SELECT ` + columnNames(columns) + ` FROM articles` + where(conditions) +
+		fmt.Sprintf(` ORDER BY %s %s, id COLLATE "C" %s`, sortKey, direction, direction)
+	if query.Count > 0 {
+		statement += ` LIMIT ` + args.add(query.Limit())
+		if query.Cursor == "" && query.Offset > 0 {
+			statement += ` OFFSET ` + args.add(query.Offset*query.Count)
+		}
+	}
+
+	results, err := ar.query(ctx, columns, statement, args...)
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+	return storage.NewArticlePage(results, query), nil
+}
+
+// Search returns a page of articles whose title or description contain any of the words in the query's text. Matches
+// in the title count for more.
+func (ar *ArticleRepository) Search(ctx context.Context, query storage.SearchQuery) ([]storage.Article, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	terms := storage.Words(query.Text)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+
+	var args queryArgs
+	tsquery := fmt.Sprintf("to_tsquery('english', %s)", args.add(strings.Join(terms, " | ")))
+	conditions := append(filterArticles(&args, query.Categories, query.Providers), fmt.Sprintf("(%s) @@ %s", searchVector, tsquery))
+	order := `published DESC, id COLLATE "C" DESC`
+	if query.Rank == storage.RankRelevance {
+		order = fmt.Sprintf("ts_rank(%s, %s) DESC, %s", searchVector, tsquery, order)
+	}
+
+	columns := selectColumns(nil)
+	statement := `SELECT ` + columnNames(columns) + ` FROM articles` + where(conditions) + ` ORDER BY ` + order
+	if query.Count > 0 {
+		statement += ` LIMIT ` + args.add(query.Count) + ` OFFSET ` + args.add(query.Offset*query.Count)
+	}
+	return ar.query(ctx, columns, statement, args...)
+}
+
+// ExpiredArticles returns the articles selected by `query`, oldest ingested first
+func (ar *ArticleRepository) ExpiredArticles(ctx context.Context, query storage.ExpiryQuery) ([]storage.Article, error) {
+	var args queryArgs
+	conditions := []string{"ingested < " + args.add(query.Before)}
+	if len(query.ProviderIDs) > 0 {
+		conditions = append(conditions, "provider_id = ANY("+args.add(pq.Array(query.ProviderIDs))+")")
+	}
+	if len(query.ExcludeProviderIDs) > 0 {
+		conditions = append(conditions, "provider_id <> ALL("+args.add(pq.Array(query.ExcludeProviderIDs))+")")
+	}
+
+	columns := selectColumns(nil)
+	statement := `SELECT ` + columnNames(columns) + ` FROM articles` + where(conditions) + ` ORDER BY ingested, id COLLATE "C"`
+	if query.Count > 0 {
+		statement += ` LIMIT ` + args.add(query.Count)
+	}
+	return ar.query(ctx, columns, statement, args...)
+}
+
+// DeleteArticles deletes the articles related to `articleIDs`, returning how many were deleted
+func (ar *ArticleRepository) DeleteArticles(ctx context.Context, articleIDs []string) (int, error) {
+	if len(articleIDs) == 0 {
+		return 0, nil
+	}
+	res, err := ar.db.ExecContext(ctx, `DELETE FROM articles WHERE id = ANY($1)`, pq.Array(articleIDs))
+	if err != nil {
+		return 0, errors.Wrap(err, "delete articles")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "rows affected")
+	}
+	return int(n), nil
+}
+
+func (ar *ArticleRepository) query(ctx context.Context, columns []articleColumn, query string, args ...interface{}) ([]storage.Article, error) {
+	rows, err := ar.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query articles")
+	}
+	defer rows.Close()
+
+	var results []storage.Article
+	for rows.Next() {
+		art, err := scanArticle(rows, columns)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan article")
+		}
+		results = append(results, art)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "read articles")
+	}
+	return results, nil
+}
+
+// filterArticles returns the conditions selecting articles in any of `categories` and from any of `providers`
+func filterArticles(args *queryArgs, categories, providers []string) []string {
+	var conditions []string
+	if len(categories) > 0 {
+		conditions = append(conditions, "categories && "+args.add(pq.Array(categories)))
+	}
+	if len(providers) > 0 {
+		conditions = append(conditions, "provider = ANY("+args.add(pq.Array(providers))+")")
+	}
+	return conditions
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// insertValues returns the values of the insert columns of `art`. Times are truncated to the microsecond Postgres
+// stores, so an unchanged article compares equal to the stored one.
+func insertValues(art storage.Article) []interface{} {
+	categories := art.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+	return []interface{}{
+		art.ID, art.ProviderID, art.Title, art.Link, art.Description, art.Content, art.Author,
+		art.Published.Truncate(time.Microsecond), art.Updated.Truncate(time.Microsecond), art.GUID, art.Thumbnail,
+		pq.Array(categories), art.Provider,
+	}
+}
+
+// insertColumns returns the columns set when an article is inserted
+func insertColumns() []string {
+	var result []string
+	for _, c := range articleColumns {
+		if c.field != "ingested" {
+			result = append(result, c.name)
+		}
+	}
+	return result
+}
+
+// selectColumns returns the columns of the article `fields`, all of them if there aren't any. The ID is always
+// selected, as it's needed for the next cursor.
+func selectColumns(fields []string) []articleColumn {
+	keep := map[string]bool{"id": true}
+	for _, f := range fields {
+		keep[f] = true
+	}
+	var result []articleColumn
+	for _, c := range articleColumns {
+		if len(fields) == 0 || keep[c.field] {
+			result = append(result, c.articleColumn)
+		}
+	}
+	return result
+}
+
+func columnNames(columns []articleColumn) string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = c.name
+	}
+	return strings.Join(names, ", ")
+}
+
+func scanArticle(s scanner, columns []articleColumn) (storage.Article, error) {
+	var art storage.Article
+	dest := make([]interface{}, len(columns))
+	for i, c := range columns {
+		dest[i] = c.dest(&art)
+	}
+	err := s.Scan(dest...)
+	if err != nil {
+		return storage.Article{}, err
+	}
+	if len(art.Categories) == 0 {
+		art.Categories = nil
+	}
+	art.Published = utc(art.Published)
+	art.Updated = utc(art.Updated)
+	art.Ingested = utc(art.Ingested)
+	return art, nil
+}
+
+// utc returns `t` in UTC, leaving zero times as they are
+func utc(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC()
+}
+
+// uniqueArticles returns `articles` with one article for each ID, as a statement can't upsert the same row twice. IDs
+// that aren't set are derived from the provider and GUID. The last article with an ID is kept, as it would win if they
+// were upserted in turn.
+func uniqueArticles(articles []storage.Article) []storage.Article {
+	index := map[string]int{}
+	var result []storage.Article
+	for _, art := range articles {
+		if art.ID == "" {
+			art.ID = storage.ArticleID(art.ProviderID, art.GUID)
+		}
+		if i, ok := index[art.ID]; ok {
+			result[i] = art
+			continue
+		}
+		index[art.ID] = len(result)
+		result = append(result, art)
+	}
+	return result
+}
@@ -0,0 +1,77 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// LeaseRepository is an implementation to manage leases in PostgreSQL
+type LeaseRepository struct {
+	db *sql.DB
+}
+
+// NewLeaseRepository returns a LeaseRepository using `db`, which must have been migrated
+func NewLeaseRepository(db *sql.DB) *LeaseRepository {
+	return &LeaseRepository{
+		db: db,
+	}
+}
+
+// AcquireLease takes or extends the lease `name` for `owner`
+func (lr *LeaseRepository) AcquireLease(ctx context.Context, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	// The conflicting lease is only replaced if it's ours or has expired, otherwise no row is affected
+	res, err := lr.db.ExecContext(ctx, `
+		INSERT INTO leases (name, owner, expires) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET owner = EXCLUDED.owner, expires = EXCLUDED.expires
+		WHERE leases.owner = EXCLUDED.owner OR leases.expires < $4`,
+		name, owner, now.Add(ttl), now)
+	if err != nil {
+		return false, errors.Wrap(err, "upsert lease")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, errors.Wrap(err, "rows affected")
+	}
+	return n > 0, nil
+}
+
+// ReleaseLease deletes the lease `name` if it's held by `owner`
+func (lr *LeaseRepository) ReleaseLease(ctx context.Context, name, owner string) error {
+	_, err := lr.db.ExecContext(ctx, `DELETE FROM leases WHERE name = $1 AND owner = $2`, name, owner)
+	if err != nil {
+		return errors.Wrap(err, "delete lease")
+	}
+	return nil
+}
+
+// GetLeases returns the unexpired leases with names beginning with `prefix`
+func (lr *LeaseRepository) GetLeases(ctx context.Context, prefix string) ([]storage.Lease, error) {
+	rows, err := lr.db.QueryContext(ctx, `
+		SELECT name, owner, expires FROM leases
+		WHERE left(name, length($1::text)) = $1 AND expires >= $2
+		ORDER BY name COLLATE "C"`,
+		prefix, time.Now())
+	if err != nil {
+		return nil, errors.Wrap(err, "query leases")
+	}
+	defer rows.Close()
+
+	result := []storage.Lease{}
+	for rows.Next() {
+		var l storage.Lease
+		err = rows.Scan(&l.Name, &l.Owner, &l.Expires)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan lease")
+		}
+		result = append(result, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "read leases")
+	}
+	return result, nil
+}
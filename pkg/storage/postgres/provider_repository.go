@@ -0,0 +1,243 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// providerColumns are selected for every provider, in the order scanProvider reads them
+const providerColumns = `id, type, label, feed_url, poll_frequency_seconds, schedule, quiet_hours, timezone, adaptive,
+	min_poll_frequency_seconds, max_poll_frequency_seconds, learned_poll_frequency_seconds, etag, last_modified,
+	consecutive_failures, last_error, last_failure, paused_until, retention_days`
+
+// ProviderRepository is an implementation to CRUD providers in PostgreSQL
+type ProviderRepository struct {
+	db *sql.DB
+}
+
+// NewProviderRepository returns a ProviderRepository using `db`, which must have been migrated
+func NewProviderRepository(db *sql.DB) *ProviderRepository {
+	return &ProviderRepository{
+		db: db,
+	}
+}
+
+// queryer is implemented by both *sql.DB and *sql.Tx
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// InsertProviders inserts providers, returning their generated IDs
+func (pr *ProviderRepository) InsertProviders(ctx context.Context, providers []storage.Provider) ([]string, error) {
+	tx, err := pr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	var insertedIDs []string
+	for _, p := range providers {
+		id, err := insertProvider(ctx, tx, p)
+		if err != nil {
+			return nil, errors.Wrap(err, "insert provider")
+		}
+		insertedIDs = append(insertedIDs, id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "commit providers")
+	}
+	return insertedIDs, nil
+}
+
+func insertProvider(ctx context.Context, q queryer, p storage.Provider) (string, error) {
+	quietHours, err := json.Marshal(p.QuietHours)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal quiet hours")
+	}
+
+	var id int64
+	err = q.QueryRowContext(ctx, `
+		INSERT INTO providers (type, label, feed_url, poll_frequency_seconds, schedule, quiet_hours, timezone, adaptive,
+			min_poll_frequency_seconds, max_poll_frequency_seconds, retention_days)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`,
+		p.Type, p.Label, p.FeedURL, p.PollFrequencySeconds, p.Schedule, quietHours, p.Timezone, p.Adaptive,
+		p.MinPollFrequencySeconds, p.MaxPollFrequencySeconds, p.RetentionDays,
+	).Scan(&id)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// GetProviders returns a page of providers. `offset` counts pages of `count` providers.
+func (pr *ProviderRepository) GetProviders(ctx context.Context, offset, count int) ([]storage.Provider, error) {
+	var args queryArgs
+	query := `SELECT ` + providerColumns + ` FROM providers ORDER BY id`
+	if count > 0 {
+		query += ` LIMIT ` + args.add(count)
+	}
+	if offset > 0 {
+		query += ` OFFSET ` + args.add(offset*count)
+	}
+
+	rows, err := pr.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query providers")
+	}
+	defer rows.Close()
+
+	var results []storage.Provider
+	for rows.Next() {
+		p, err := scanProvider(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan provider")
+		}
+		results = append(results, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "read providers")
+	}
+	return results, nil
+}
+
+// GetProvider returns the provider related to the specified `providerID`. `storage.ErrNotFound` is returned if there's
+// no such provider.
+func (pr *ProviderRepository) GetProvider(ctx context.Context, providerID string) (storage.Provider, error) {
+	id, ok := parseProviderID(providerID)
+	if !ok {
+		return storage.Provider{}, providerNotFound(providerID)
+	}
+
+	row := pr.db.QueryRowContext(ctx, `SELECT `+providerColumns+` FROM providers WHERE id = $1`, id)
+	p, err := scanProvider(row)
+	if err == sql.ErrNoRows {
+		return storage.Provider{}, providerNotFound(providerID)
+	}
+	if err != nil {
+		return storage.Provider{}, errors.Wrap(err, "get provider")
+	}
+	return p, nil
+}
+
+// UpdateProvider replaces the configuration of the provider related to `provider.ID`, resetting its fetch state, poll
+// status and learned poll frequency. `storage.ErrNotFound` is returned if there's no such provider.
+func (pr *ProviderRepository) UpdateProvider(ctx context.Context, provider storage.Provider) error {
+	quietHours, err := json.Marshal(provider.QuietHours)
+	if err != nil {
+		return errors.Wrap(err, "marshal quiet hours")
+	}
+	return pr.update(ctx, provider.ID, `
+		type = $2, label = $3, feed_url = $4, poll_frequency_seconds = $5, schedule = $6, quiet_hours = $7,
+		timezone = $8, adaptive = $9, min_poll_frequency_seconds = $10, max_poll_frequency_seconds = $11,
+		retention_days = $12, learned_poll_frequency_seconds = DEFAULT, etag = DEFAULT, last_modified = DEFAULT,
+		consecutive_failures = DEFAULT, last_error = DEFAULT, last_failure = DEFAULT, paused_until = DEFAULT`,
+		provider.Type, provider.Label, provider.FeedURL, provider.PollFrequencySeconds, provider.Schedule, quietHours,
+		provider.Timezone, provider.Adaptive, provider.MinPollFrequencySeconds, provider.MaxPollFrequencySeconds,
+		provider.RetentionDays,
+	)
+}
+
+// DeleteProvider deletes the provider related to `providerID`. `storage.ErrNotFound` is returned if there's no such
+// provider.
+func (pr *ProviderRepository) DeleteProvider(ctx context.Context, providerID string) error {
+	id, ok := parseProviderID(providerID)
+	if !ok {
+		return providerNotFound(providerID)
+	}
+
+	res, err := pr.db.ExecContext(ctx, `DELETE FROM providers WHERE id = $1`, id)
+	if err != nil {
+		return errors.Wrap(err, "delete provider")
+	}
+	return checkAffected(res, providerID)
+}
+
+// UpdateFetchState replaces the fetch state of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdateFetchState(ctx context.Context, providerID string, state storage.FetchState) error {
+	return pr.update(ctx, providerID, `etag = $2, last_modified = $3`, state.ETag, state.LastModified)
+}
+
+// UpdatePollStatus replaces the poll status of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdatePollStatus(ctx context.Context, providerID string, status storage.PollStatus) error {
+	return pr.update(ctx, providerID, `consecutive_failures = $2, last_error = $3, last_failure = $4, paused_until = $5`,
+		status.ConsecutiveFailures, status.LastError, status.LastFailure, status.PausedUntil)
+}
+
+// UpdateLearnedPollFrequency records the poll frequency learned by adaptive polling of the provider related to the
+// specified `providerID`
+func (pr *ProviderRepository) UpdateLearnedPollFrequency(ctx context.Context, providerID string, seconds int) error {
+	return pr.update(ctx, providerID, `learned_poll_frequency_seconds = $2`, seconds)
+}
+
+// update sets the columns in `set` of the provider related to `providerID`, which is the first argument. The values
+// in `args` follow it. `storage.ErrNotFound` is returned if there's no such provider.
+func (pr *ProviderRepository) update(ctx context.Context, providerID, set string, args ...interface{}) error {
+	id, ok := parseProviderID(providerID)
+	if !ok {
+		return providerNotFound(providerID)
+	}
+
+	res, err := pr.db.ExecContext(ctx, `UPDATE providers SET `+set+` WHERE id = $1`, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return errors.Wrap(err, "update provider")
+	}
+	return checkAffected(res, providerID)
+}
+
+func checkAffected(res sql.Result, providerID string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+	if n == 0 {
+		return providerNotFound(providerID)
+	}
+	return nil
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanProvider(s scanner) (storage.Provider, error) {
+	var p storage.Provider
+	var id int64
+	var quietHours []byte
+	err := s.Scan(&id, &p.Type, &p.Label, &p.FeedURL, &p.PollFrequencySeconds, &p.Schedule, &quietHours, &p.Timezone,
+		&p.Adaptive, &p.MinPollFrequencySeconds, &p.MaxPollFrequencySeconds, &p.LearnedPollFrequencySeconds,
+		&p.FetchState.ETag, &p.FetchState.LastModified, &p.Status.ConsecutiveFailures, &p.Status.LastError,
+		&p.Status.LastFailure, &p.Status.PausedUntil, &p.RetentionDays)
+	if err != nil {
+		return storage.Provider{}, err
+	}
+	err = json.Unmarshal(quietHours, &p.QuietHours)
+	if err != nil {
+		return storage.Provider{}, errors.Wrap(err, "unmarshal quiet hours")
+	}
+	p.ID = strconv.FormatInt(id, 10)
+	p.Status.LastFailure = p.Status.LastFailure.UTC()
+	p.Status.PausedUntil = p.Status.PausedUntil.UTC()
+	return p, nil
+}
+
+// parseProviderID parses a provider ID, which is false if it can't be the ID of a provider
+func parseProviderID(providerID string) (int64, bool) {
+	id, err := strconv.ParseInt(providerID, 10, 64)
+	return id, err == nil && id > 0
+}
+
+func providerNotFound(providerID string) error {
+	return storage.ErrNotFound{
+		Message: fmt.Sprintf("No provider found for ID `%s`", providerID),
+	}
+}
@@ -2,6 +2,10 @@ package storage
 
 import (
 	"context"
+	"time"
+
+	"github.com/chackett/zignews/pkg/schedule"
+	"github.com/pkg/errors"
 )
 
 // ErrNotFound is returned when an item requested is not found
@@ -13,12 +17,119 @@ func (e ErrNotFound) Error() string {
 	return e.Message
 }
 
+// ErrInvalidProvider is returned when a provider's configuration isn't valid
+type ErrInvalidProvider struct {
+	Message string
+}
+
+func (e ErrInvalidProvider) Error() string {
+	return e.Message
+}
+
 // Provider represents a provider
 type Provider struct {
+	ID                   string `json:"id,omitempty" bson:"_id,omitempty"`
 	Type                 string `json:"type,omitempty"`
 	Label                string `json:"label,omitempty"`
 	FeedURL              string `json:"feedURL,omitempty"`
 	PollFrequencySeconds int    `json:"pollFrequencySeconds,omitempty"`
+	// Schedule is an optional cron expression, used instead of PollFrequencySeconds
+	Schedule string `json:"schedule,omitempty"`
+	// QuietHours are times of day during which polling slows down or pauses
+	QuietHours []schedule.Window `json:"quietHours,omitempty"`
+	// Timezone is the IANA time zone the schedule and quiet hours are in. Defaults to UTC.
+	Timezone string `json:"timezone,omitempty"`
+	// Adaptive polling adjusts the time between polls to how often the feed publishes new articles, within
+	// MinPollFrequencySeconds and MaxPollFrequencySeconds. It starts from PollFrequencySeconds.
+	Adaptive                bool `json:"adaptive,omitempty"`
+	MinPollFrequencySeconds int  `json:"minPollFrequencySeconds,omitempty"`
+	MaxPollFrequencySeconds int  `json:"maxPollFrequencySeconds,omitempty"`
+	// LearnedPollFrequencySeconds is the time between polls learned by adaptive polling
+	LearnedPollFrequencySeconds int `json:"learnedPollFrequencySeconds,omitempty"`
+	// RetentionDays is how long the provider's articles are kept after they're ingested. Zero uses the global
+	// retention policy.
+	RetentionDays int        `json:"retentionDays,omitempty"`
+	FetchState    FetchState `json:"fetchState,omitempty"`
+	Status        PollStatus `json:"status,omitempty"`
+}
+
+// Validate checks the configuration common to all provider types, so providers can't be stored or run with limits
+// that weren't enforced. Type specific configuration is validated by the aggregator's provider factories.
+func (p Provider) Validate() error {
+	if p.Label == "" {
+		return errors.New("provider label is required")
+	}
+	if p.RetentionDays < 0 {
+		return errors.New("retention days must not be negative")
+	}
+	if p.Adaptive {
+		err := p.validateAdaptive()
+		if err != nil {
+			return err
+		}
+	}
+	_, err := p.PollSchedule()
+	return err
+}
+
+func (p Provider) validateAdaptive() error {
+	if p.Schedule != "" {
+		return errors.New("adaptive polling can't be used with a cron schedule")
+	}
+	min, max := p.PollFrequencyBounds()
+	err := schedule.ValidateFrequency(min)
+	if err != nil {
+		return errors.Wrap(err, "minimum adaptive polling frequency")
+	}
+	err = schedule.ValidateFrequency(max)
+	if err != nil {
+		return errors.Wrap(err, "maximum adaptive polling frequency")
+	}
+	if min > max {
+		return errors.New("minimum adaptive polling frequency must not be more than the maximum")
+	}
+	return nil
+}
+
+// PollFrequencyBounds returns the range adaptive polling keeps the time between polls within
+func (p Provider) PollFrequencyBounds() (min, max time.Duration) {
+	return time.Duration(p.MinPollFrequencySeconds) * time.Second, time.Duration(p.MaxPollFrequencySeconds) * time.Second
+}
+
+// PollSchedule returns the schedule the provider is polled on. For adaptive polling it resumes from the learned
+// frequency.
+func (p Provider) PollSchedule() (*schedule.Schedule, error) {
+	interval := time.Duration(p.PollFrequencySeconds) * time.Second
+	if p.Adaptive {
+		if p.LearnedPollFrequencySeconds > 0 {
+			interval = time.Duration(p.LearnedPollFrequencySeconds) * time.Second
+		}
+		min, max := p.PollFrequencyBounds()
+		if interval < min {
+			interval = min
+		}
+		if interval > max {
+			interval = max
+		}
+	}
+	return schedule.New(interval, p.Schedule, p.QuietHours, p.Timezone)
+}
+
+// FetchState is recorded by the aggregator between polls of a provider
+type FetchState struct {
+	// ETag and LastModified are the HTTP cache validators returned with the last successful fetch
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+}
+
+// PollStatus is recorded by the aggregator when polling a provider starts or stops failing, so operators can see which
+// feeds are broken
+type PollStatus struct {
+	ConsecutiveFailures int       `json:"consecutiveFailures,omitempty"`
+	LastError           string    `json:"lastError,omitempty"`
+	LastFailure         time.Time `json:"lastFailure,omitempty"`
+	// PausedUntil is set when too many consecutive failures have paused polling of the provider
+	PausedUntil time.Time `json:"pausedUntil,omitempty"`
 }
 
 // ProviderRepository defines functionality to CRUD providers in underlying store
@@ -26,4 +137,11 @@ type ProviderRepository interface {
 	InsertProviders(ctx context.Context, p []Provider) ([]string, error)
 	GetProviders(ctx context.Context, offset, count int) ([]Provider, error)
 	GetProvider(ctx context.Context, providerID string) (Provider, error)
+	// UpdateProvider replaces the configuration of an existing provider, identified by `provider.ID`. Fetch state,
+	// poll status and the learned poll frequency are reset, as they may not apply to the new configuration.
+	UpdateProvider(ctx context.Context, provider Provider) error
+	DeleteProvider(ctx context.Context, providerID string) error
+	UpdateFetchState(ctx context.Context, providerID string, state FetchState) error
+	UpdatePollStatus(ctx context.Context, providerID string, status PollStatus) error
+	UpdateLearnedPollFrequency(ctx context.Context, providerID string, seconds int) error
 }
@@ -0,0 +1,427 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// searchRank scores search matches, weighting the title above the description as the Mongo text index does. Lower
+// scores are better matches.
+const searchRank = `bm25(articles_search, 3.0, 1.0)`
+
+// articleColumn is the column holding an article field
+type articleColumn struct {
+	field string
+	name  string
+	dest  func(a *storage.Article, categories *string) interface{}
+}
+
+// articleColumns are the columns of the article fields, in the order they're selected
+var articleColumns = []articleColumn{
+	{"id", "id", func(a *storage.Article, _ *string) interface{} { return &a.ID }},
+	{"providerID", "provider_id", func(a *storage.Article, _ *string) interface{} { return &a.ProviderID }},
+	{"title", "title", func(a *storage.Article, _ *string) interface{} { return &a.Title }},
+	{"link", "link", func(a *storage.Article, _ *string) interface{} { return &a.Link }},
+	{"description", "description", func(a *storage.Article, _ *string) interface{} { return &a.Description }},
+	{"content", "content", func(a *storage.Article, _ *string) interface{} { return &a.Content }},
+	{"author", "author", func(a *storage.Article, _ *string) interface{} { return &a.Author }},
+	{"published", "published", func(a *storage.Article, _ *string) interface{} { return timeValue{&a.Published} }},
+	{"updated", "updated", func(a *storage.Article, _ *string) interface{} { return timeValue{&a.Updated} }},
+	{"ingested", "ingested", func(a *storage.Article, _ *string) interface{} { return timeValue{&a.Ingested} }},
+	{"guid", "guid", func(a *storage.Article, _ *string) interface{} { return &a.GUID }},
+	{"thumbnail", "thumbnail", func(a *storage.Article, _ *string) interface{} { return &a.Thumbnail }},
+	{"categories", "categories", func(_ *storage.Article, c *string) interface{} { return c }},
+	{"provider", "provider", func(a *storage.Article, _ *string) interface{} { return &a.Provider }},
+}
+
+// ArticleRepository is an implementation to CRUD articles in SQLite
+type ArticleRepository struct {
+	db *sql.DB
+}
+
+// NewArticleRepository returns an ArticleRepository using `db`, which must have been migrated
+func NewArticleRepository(db *sql.DB) *ArticleRepository {
+	return &ArticleRepository{
+		db: db,
+	}
+}
+
+// InsertArticles upserts articles by ID, reporting which were inserted, modified or unchanged. Articles are only
+// updated when they've changed, and keep the time they were first ingested.
+func (ar *ArticleRepository) InsertArticles(ctx context.Context, articles []storage.Article) (storage.InsertResult, error) {
+	var result storage.InsertResult
+	tx, err := ar.db.BeginTx(ctx, nil)
+	if err != nil {
+		return result, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	now := formatTime(time.Now())
+	for _, art := range uniqueArticles(articles) {
+		categories, err := json.Marshal(art.Categories)
+		if err != nil {
+			return storage.InsertResult{}, errors.Wrap(err, "marshal categories")
+		}
+
+		var seq int64
+		var stored storage.Article
+		var storedCategories string
+		columns := selectColumns(nil)
+		row := tx.QueryRowContext(ctx, `SELECT a.seq, `+columnNames(columns)+` FROM articles a WHERE id = ?`, art.ID)
+		err = row.Scan(append([]interface{}{&seq}, scanDest(columns, &stored, &storedCategories)...)...)
+		exists := err == nil
+		if err != nil && err != sql.ErrNoRows {
+			return storage.InsertResult{}, errors.Wrap(err, "get stored article")
+		}
+		if exists && sameArticle(stored, storedCategories, art, string(categories)) {
+			result.Unchanged = append(result.Unchanged, art.ID)
+			continue
+		}
+
+		values := []interface{}{
+			art.ProviderID, art.Title, art.Link, art.Description, art.Content, art.Author,
+			formatTime(art.Published), formatTime(art.Updated), art.Thumbnail, string(categories), art.Provider,
+		}
+		if exists {
+			_, err = tx.ExecContext(ctx, `
+				UPDATE articles SET provider_id = ?, title = ?, link = ?, description = ?, content = ?, author = ?,
+					published = ?, updated = ?, thumbnail = ?, categories = ?, provider = ?
+				WHERE seq = ?`, append(values, seq)...)
+			if err != nil {
+				return storage.InsertResult{}, errors.Wrap(err, "update article")
+			}
+			_, err = tx.ExecContext(ctx, `DELETE FROM article_categories WHERE seq = ?`, seq)
+			if err != nil {
+				return storage.InsertResult{}, errors.Wrap(err, "delete article categories")
+			}
+		} else {
+			res, err := tx.ExecContext(ctx, `
+				INSERT INTO articles (provider_id, title, link, description, content, author, published, updated,
+					thumbnail, categories, provider, id, guid, ingested)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, append(values, art.ID, art.GUID, now)...)
+			if err != nil {
+				return storage.InsertResult{}, errors.Wrap(err, "insert article")
+			}
+			seq, err = res.LastInsertId()
+			if err != nil {
+				return storage.InsertResult{}, errors.Wrap(err, "last insert id")
+			}
+		}
+		for _, c := range art.Categories {
+			_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO article_categories (seq, category) VALUES (?, ?)`, seq, c)
+			if err != nil {
+				return storage.InsertResult{}, errors.Wrap(err, "insert article category")
+			}
+		}
+
+		if exists {
+			result.Modified = append(result.Modified, art.ID)
+		} else {
+			result.Inserted = append(result.Inserted, art.ID)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return storage.InsertResult{}, errors.Wrap(err, "commit articles")
+	}
+	return result, nil
+}
+
+// GetArticle returns the article related to `articleID`. `storage.ErrNotFound` is returned if there's no such article.
+func (ar *ArticleRepository) GetArticle(ctx context.Context, articleID string) (storage.Article, error) {
+	columns := selectColumns(nil)
+	row := ar.db.QueryRowContext(ctx, `SELECT `+columnNames(columns)+` FROM articles a WHERE id = ?`, articleID)
+	art, err := scanArticle(row, columns)
+	if err == sql.ErrNoRows {
+		return storage.Article{}, storage.ErrNotFound{
+			Message: fmt.Sprintf("No article found for ID `%s`", articleID),
+		}
+	}
+	if err != nil {
+		return storage.Article{}, errors.Wrap(err, "get article")
+	}
+	return art, nil
+}
+
+// GetArticles returns a page of articles in the query's order. Pages follow the query's cursor if it's set, otherwise
+// they're skipped by offset.
+func (ar *ArticleRepository) GetArticles(ctx context.Context, query storage.ArticleQuery) (storage.ArticlePage, error) {
+	err := query.Validate()
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+
+	conditions, args := filterArticles(query.Categories, query.Providers)
+	if !query.Since.IsZero() {
+		conditions = append(conditions, "a.published >= ?")
+		args = append(args, formatTime(query.Since))
+	}
+	if !query.Until.IsZero() {
+		conditions = append(conditions, "a.published < ?")
+		args = append(args, formatTime(query.Until))
+	}
+
+	sortKey := "a." + query.SortField()
+	direction, compare := "ASC", ">"
+	if query.Descending() {
+		direction, compare = "DESC", "<"
+	}
+
+	if query.Cursor != "" {
+		cursor, err := storage.DecodeCursor(query)
+		if err != nil {
+			return storage.ArticlePage{}, err
+		}
+		// Keyset pagination, so the page starts after the cursor regardless of what's been inserted since
+		after := formatTime(cursor.Time)
+		if query.SortField() == storage.SortTitle {
+			after = cursor.Title
+		}
+		conditions = append(conditions, fmt.Sprintf("(%s, a.id) %s (?, ?)", sortKey, compare))
+		args = append(args, after, cursor.ID)
+	}
+
+	var fields []string
+	if len(query.Fields) > 0 {
+		// The sort field is needed for the next cursor
+		fields = append([]string{query.SortField()}, query.Fields...)
+	}
+	columns := selectColumns(fields)
+	statement := `SELECT ` + columnNames(columns) + ` FROM articles a` + where(conditions) +
+		fmt.Sprintf(` ORDER BY %s %s, a.id %s`, sortKey, direction, direction)
+	if query.Count > 0 {
+		statement += ` LIMIT ?`
+		args = append(args, query.Limit())
+		if query.Cursor == "" {
+			statement += ` OFFSET ?`
+			args = append(args, query.Offset*query.Count)
+		}
+	}
+
+	results, err := ar.query(ctx, columns, statement, args...)
+	if err != nil {
+		return storage.ArticlePage{}, err
+	}
+	return storage.NewArticlePage(results, query), nil
+}
+
+// Search returns a page of articles whose title or description contain any of the words in the query's text. Matches
+// in the title count for more.
+func (ar *ArticleRepository) Search(ctx context.Context, query storage.SearchQuery) ([]storage.Article, error) {
+	err := query.Validate()
+	if err != nil {
+		return nil, err
+	}
+	terms := storage.Words(query.Text)
+	if len(terms) == 0 {
+		return nil, nil
+	}
+	// Each word is quoted, so it's matched as a word rather than parsed as FTS5 syntax
+	match := `"` + strings.Join(terms, `" OR "`) + `"`
+
+	conditions, args := filterArticles(query.Categories, query.Providers)
+	conditions = append([]string{"articles_search MATCH ?"}, conditions...)
+	args = append([]interface{}{match}, args...)
+	order := "a.published DESC, a.id DESC"
+	if query.Rank == storage.RankRelevance {
+		order = searchRank + ", " + order
+	}
+
+	columns := selectColumns(nil)
+	statement := `SELECT ` + columnNames(columns) + ` FROM articles_search JOIN articles a ON a.seq = articles_search.rowid` +
+		where(conditions) + ` ORDER BY ` + order
+	if query.Count > 0 {
+		statement += ` LIMIT ? OFFSET ?`
+		args = append(args, query.Count, query.Offset*query.Count)
+	}
+	return ar.query(ctx, columns, statement, args...)
+}
+
+// ExpiredArticles returns the articles selected by `query`, oldest ingested first
+func (ar *ArticleRepository) ExpiredArticles(ctx context.Context, query storage.ExpiryQuery) ([]storage.Article, error) {
+	conditions := []string{"a.ingested < ?"}
+	args := []interface{}{formatTime(query.Before)}
+	if len(query.ProviderIDs) > 0 {
+		conditions = append(conditions, "a.provider_id IN ("+placeholders(len(query.ProviderIDs))+")")
+		for _, id := range query.ProviderIDs {
+			args = append(args, id)
+		}
+	}
+	if len(query.ExcludeProviderIDs) > 0 {
+		conditions = append(conditions, "a.provider_id NOT IN ("+placeholders(len(query.ExcludeProviderIDs))+")")
+		for _, id := range query.ExcludeProviderIDs {
+			args = append(args, id)
+		}
+	}
+
+	columns := selectColumns(nil)
+	statement := `SELECT ` + columnNames(columns) + ` FROM articles a` + where(conditions) + ` ORDER BY a.ingested, a.id`
+	if query.Count > 0 {
+		statement += ` LIMIT ?`
+		args = append(args, query.Count)
+	}
+	return ar.query(ctx, columns, statement, args...)
+}
+
+// DeleteArticles deletes the articles related to `articleIDs`, returning how many were deleted. Their categories and
+// search entries go with them.
+func (ar *ArticleRepository) DeleteArticles(ctx context.Context, articleIDs []string) (int, error) {
+	if len(articleIDs) == 0 {
+		return 0, nil
+	}
+	args := make([]interface{}, len(articleIDs))
+	for i, id := range articleIDs {
+		args[i] = id
+	}
+	res, err := ar.db.ExecContext(ctx, `DELETE FROM articles WHERE id IN (`+placeholders(len(articleIDs))+`)`, args...)
+	if err != nil {
+		return 0, errors.Wrap(err, "delete articles")
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.Wrap(err, "rows affected")
+	}
+	return int(n), nil
+}
+
+func (ar *ArticleRepository) query(ctx context.Context, columns []articleColumn, query string, args ...interface{}) ([]storage.Article, error) {
+	rows, err := ar.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrap(err, "query articles")
+	}
+	defer rows.Close()
+
+	var results []storage.Article
+	for rows.Next() {
+		art, err := scanArticle(rows, columns)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan article")
+		}
+		results = append(results, art)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "read articles")
+	}
+	return results, nil
+}
+
+// filterArticles returns the conditions selecting articles in any of `categories` and from any of `providers`, with
+// their arguments
+func filterArticles(categories, providers []string) ([]string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if len(categories) > 0 {
+		conditions = append(conditions, "a.seq IN (SELECT seq FROM article_categories WHERE category IN ("+placeholders(len(categories))+"))")
+		for _, c := range categories {
+			args = append(args, c)
+		}
+	}
+	if len(providers) > 0 {
+		conditions = append(conditions, "a.provider IN ("+placeholders(len(providers))+")")
+		for _, p := range providers {
+			args = append(args, p)
+		}
+	}
+	return conditions, args
+}
+
+func where(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
+
+// selectColumns returns the columns of the article `fields`, all of them if there aren't any. The ID is always
+// selected, as it's needed for the next cursor.
+func selectColumns(fields []string) []articleColumn {
+	keep := map[string]bool{"id": true}
+	for _, f := range fields {
+		keep[f] = true
+	}
+	var result []articleColumn
+	for _, c := range articleColumns {
+		if len(fields) == 0 || keep[c.field] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// columnNames returns the names of `columns` in the articles table, aliased `a`
+func columnNames(columns []articleColumn) string {
+	names := make([]string, len(columns))
+	for i, c := range columns {
+		names[i] = "a." + c.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// scanDest returns where to scan `columns` into `art`. Categories are scanned as JSON into `categories`.
+func scanDest(columns []articleColumn, art *storage.Article, categories *string) []interface{} {
+	dest := make([]interface{}, len(columns))
+	for i, c := range columns {
+		dest[i] = c.dest(art, categories)
+	}
+	return dest
+}
+
+func scanArticle(s scanner, columns []articleColumn) (storage.Article, error) {
+	var art storage.Article
+	var categories string
+	err := s.Scan(scanDest(columns, &art, &categories)...)
+	if err != nil {
+		return storage.Article{}, err
+	}
+	if categories != "" {
+		err = json.Unmarshal([]byte(categories), &art.Categories)
+		if err != nil {
+			return storage.Article{}, errors.Wrap(err, "unmarshal categories")
+		}
+	}
+	return art, nil
+}
+
+// sameArticle reports whether the stored article `stored` already holds `art`. Categories are compared as JSON.
+// Ingested isn't compared, as it's set by the repository.
+func sameArticle(stored storage.Article, storedCategories string, art storage.Article, categories string) bool {
+	return stored.ID == art.ID &&
+		stored.ProviderID == art.ProviderID &&
+		stored.Title == art.Title &&
+		stored.Link == art.Link &&
+		stored.Description == art.Description &&
+		stored.Content == art.Content &&
+		stored.Author == art.Author &&
+		stored.Published.Equal(art.Published) &&
+		stored.Updated.Equal(art.Updated) &&
+		stored.Thumbnail == art.Thumbnail &&
+		storedCategories == categories &&
+		stored.Provider == art.Provider
+}
+
+// uniqueArticles returns `articles` with one article for each ID, deriving IDs that aren't set from the provider and
+// GUID. The last article with an ID is kept, as it would win if they were upserted in turn.
+func uniqueArticles(articles []storage.Article) []storage.Article {
+	index := map[string]int{}
+	var result []storage.Article
+	for _, art := range articles {
+		if art.ID == "" {
+			art.ID = storage.ArticleID(art.ProviderID, art.GUID)
+		}
+		if i, ok := index[art.ID]; ok {
+			result[i] = art
+			continue
+		}
+		index[art.ID] = len(result)
+		result = append(result, art)
+	}
+	return result
+}
@@ -0,0 +1,178 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// migration brings the schema from the previous version to the next. Migrations are never changed once released, new
+// ones are appended.
+type migration struct {
+	description string
+	up          func(ctx context.Context, tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{"create providers, articles and leases", execMigration(`
+		CREATE TABLE providers (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			type TEXT NOT NULL,
+			label TEXT NOT NULL,
+			feed_url TEXT NOT NULL,
+			poll_frequency_seconds INTEGER NOT NULL DEFAULT 0,
+			schedule TEXT NOT NULL DEFAULT '',
+			quiet_hours TEXT NOT NULL DEFAULT 'null',
+			timezone TEXT NOT NULL DEFAULT '',
+			adaptive BOOLEAN NOT NULL DEFAULT FALSE,
+			min_poll_frequency_seconds INTEGER NOT NULL DEFAULT 0,
+			max_poll_frequency_seconds INTEGER NOT NULL DEFAULT 0,
+			learned_poll_frequency_seconds INTEGER NOT NULL DEFAULT 0,
+			etag TEXT NOT NULL DEFAULT '',
+			last_modified TEXT NOT NULL DEFAULT '',
+			consecutive_failures INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			last_failure TEXT NOT NULL DEFAULT '0001-01-01T00:00:00.000000000Z',
+			paused_until TEXT NOT NULL DEFAULT '0001-01-01T00:00:00.000000000Z'
+		);
+
+		CREATE TABLE articles (
+			seq INTEGER PRIMARY KEY,
+			id TEXT NOT NULL UNIQUE,
+			provider_id TEXT NOT NULL,
+			guid TEXT NOT NULL,
+			title TEXT NOT NULL,
+			link TEXT NOT NULL,
+			description TEXT NOT NULL,
+			content TEXT NOT NULL,
+			author TEXT NOT NULL,
+			published TEXT NOT NULL,
+			updated TEXT NOT NULL,
+			ingested TEXT NOT NULL,
+			thumbnail TEXT NOT NULL,
+			categories TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			UNIQUE (provider_id, guid)
+		);
+		CREATE INDEX articles_published ON articles (published, id);
+		CREATE INDEX articles_ingested ON articles (ingested, id);
+		CREATE INDEX articles_title ON articles (title, id);
+
+		-- Categories are held in the article as JSON, and here so articles can be filtered by them
+		CREATE TABLE article_categories (
+			seq INTEGER NOT NULL REFERENCES articles (seq) ON DELETE CASCADE,
+			category TEXT NOT NULL,
+			PRIMARY KEY (category, seq)
+		);
+		CREATE INDEX article_categories_seq ON article_categories (seq);
+
+		-- The search index is kept up to date with the articles by triggers
+		CREATE VIRTUAL TABLE articles_search USING fts5(
+			title, description, content='articles', content_rowid='seq', tokenize='porter unicode61'
+		);
+		CREATE TRIGGER articles_search_insert AFTER INSERT ON articles BEGIN
+			INSERT INTO articles_search (rowid, title, description) VALUES (new.seq, new.title, new.description);
+		END;
+		CREATE TRIGGER articles_search_delete AFTER DELETE ON articles BEGIN
+			INSERT INTO articles_search (articles_search, rowid, title, description)
+			VALUES ('delete', old.seq, old.title, old.description);
+		END;
+		CREATE TRIGGER articles_search_update AFTER UPDATE ON articles BEGIN
+			INSERT INTO articles_search (articles_search, rowid, title, description)
+			VALUES ('delete', old.seq, old.title, old.description);
+			INSERT INTO articles_search (rowid, title, description) VALUES (new.seq, new.title, new.description);
+		END;
+
+		CREATE TABLE leases (
+			name TEXT PRIMARY KEY,
+			owner TEXT NOT NULL,
+			expires TEXT NOT NULL
+		);
+	`)},
+	{"bootstrap providers", bootstrapProviders},
+	{"add provider retention", execMigration(`
+		ALTER TABLE providers ADD COLUMN retention_days INTEGER NOT NULL DEFAULT 0;
+		CREATE INDEX articles_provider_ingested ON articles (provider_id, ingested);
+	`)},
+}
+
+// Migrate applies the migrations the database hasn't had, recording each version in the `schema_migrations` table
+func Migrate(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied TEXT NOT NULL
+		)`)
+	if err != nil {
+		return errors.Wrap(err, "create schema_migrations")
+	}
+
+	var current int
+	err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return errors.Wrap(err, "get schema version")
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version, m := i+1, migrations[i]
+		log.Printf("Applying migration %d - %s", version, m.description)
+		err = m.up(ctx, tx)
+		if err != nil {
+			return errors.Wrapf(err, "migration %d", version)
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, description, applied) VALUES (?, ?, datetime('now'))`, version, m.description)
+		if err != nil {
+			return errors.Wrapf(err, "record migration %d", version)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.Wrap(err, "commit migrations")
+	}
+	return nil
+}
+
+func execMigration(query string) func(ctx context.Context, tx *sql.Tx) error {
+	return func(ctx context.Context, tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, query)
+		return err
+	}
+}
+
+// bootstrapProviders inserts the default providers, so a new database has news to aggregate
+func bootstrapProviders(ctx context.Context, tx *sql.Tx) error {
+	for _, p := range storage.DefaultProviders() {
+		err := p.Validate()
+		if err != nil {
+			return errors.Wrapf(err, "validate bootstrap provider `%s`", p.Label)
+		}
+		quietHours, err := json.Marshal(p.QuietHours)
+		if err != nil {
+			return errors.Wrap(err, "marshal quiet hours")
+		}
+		// The columns are those of the schema at this version, rather than the latest ones insertProvider writes
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO providers (type, label, feed_url, poll_frequency_seconds, schedule, quiet_hours, timezone,
+				adaptive, min_poll_frequency_seconds, max_poll_frequency_seconds)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			p.Type, p.Label, p.FeedURL, p.PollFrequencySeconds, p.Schedule, string(quietHours), p.Timezone, p.Adaptive,
+			p.MinPollFrequencySeconds, p.MaxPollFrequencySeconds,
+		)
+		if err != nil {
+			return errors.Wrapf(err, "insert bootstrap provider `%s`", p.Label)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// providerColumns are selected for every provider, in the order scanProvider reads them
+const providerColumns = `id, type, label, feed_url, poll_frequency_seconds, schedule, quiet_hours, timezone, adaptive,
+	min_poll_frequency_seconds, max_poll_frequency_seconds, learned_poll_frequency_seconds, etag, last_modified,
+	consecutive_failures, last_error, last_failure, paused_until, retention_days`
+
+// ProviderRepository is an implementation to CRUD providers in SQLite
+type ProviderRepository struct {
+	db *sql.DB
+}
+
+// NewProviderRepository returns a ProviderRepository using `db`, which must have been migrated
+func NewProviderRepository(db *sql.DB) *ProviderRepository {
+	return &ProviderRepository{
+		db: db,
+	}
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// InsertProviders inserts providers, returning their generated IDs
+func (pr *ProviderRepository) InsertProviders(ctx context.Context, providers []storage.Provider) ([]string, error) {
+	tx, err := pr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "begin transaction")
+	}
+	defer tx.Rollback()
+
+	var insertedIDs []string
+	for _, p := range providers {
+		id, err := insertProvider(ctx, tx, p)
+		if err != nil {
+			return nil, errors.Wrap(err, "insert provider")
+		}
+		insertedIDs = append(insertedIDs, id)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.Wrap(err, "commit providers")
+	}
+	return insertedIDs, nil
+}
+
+func insertProvider(ctx context.Context, e execer, p storage.Provider) (string, error) {
+	quietHours, err := json.Marshal(p.QuietHours)
+	if err != nil {
+		return "", errors.Wrap(err, "marshal quiet hours")
+	}
+
+	res, err := e.ExecContext(ctx, `
+		INSERT INTO providers (type, label, feed_url, poll_frequency_seconds, schedule, quiet_hours, timezone, adaptive,
+			min_poll_frequency_seconds, max_poll_frequency_seconds, retention_days)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		p.Type, p.Label, p.FeedURL, p.PollFrequencySeconds, p.Schedule, string(quietHours), p.Timezone, p.Adaptive,
+		p.MinPollFrequencySeconds, p.MaxPollFrequencySeconds, p.RetentionDays,
+	)
+	if err != nil {
+		return "", err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return "", errors.Wrap(err, "last insert id")
+	}
+	return strconv.FormatInt(id, 10), nil
+}
+
+// GetProviders returns a page of providers. `offset` counts pages of `count` providers.
+func (pr *ProviderRepository) GetProviders(ctx context.Context, offset, count int) ([]storage.Provider, error) {
+	if count <= 0 {
+		// No limit, as for Mongo
+		count = -1
+	}
+	rows, err := pr.db.QueryContext(ctx, `SELECT `+providerColumns+` FROM providers ORDER BY id LIMIT ? OFFSET ?`,
+		count, offset*count)
+	if err != nil {
+		return nil, errors.Wrap(err, "query providers")
+	}
+	defer rows.Close()
+
+	var results []storage.Provider
+	for rows.Next() {
+		p, err := scanProvider(rows)
+		if err != nil {
+			return nil, errors.Wrap(err, "scan provider")
+		}
+		results = append(results, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, errors.Wrap(err, "read providers")
+	}
+	return results, nil
+}
+
+// GetProvider returns the provider related to the specified `providerID`. `storage.ErrNotFound` is returned if there's
+// no such provider.
+func (pr *ProviderRepository) GetProvider(ctx context.Context, providerID string) (storage.Provider, error) {
+	id, ok := parseProviderID(providerID)
+	if !ok {
+		return storage.Provider{}, providerNotFound(providerID)
+	}
+
+	row := pr.db.QueryRowContext(ctx, `SELECT `+providerColumns+` FROM providers WHERE id = ?`, id)
+	p, err := scanProvider(row)
+	if err == sql.ErrNoRows {
+		return storage.Provider{}, providerNotFound(providerID)
+	}
+	if err != nil {
+		return storage.Provider{}, errors.Wrap(err, "get provider")
+	}
+	return p, nil
+}
+
+// UpdateProvider replaces the configuration of the provider related to `provider.ID`, resetting its fetch state, poll
+// status and learned poll frequency. `storage.ErrNotFound` is returned if there's no such provider.
+func (pr *ProviderRepository) UpdateProvider(ctx context.Context, provider storage.Provider) error {
+	quietHours, err := json.Marshal(provider.QuietHours)
+	if err != nil {
+		return errors.Wrap(err, "marshal quiet hours")
+	}
+	var zero storage.PollStatus
+	return pr.update(ctx, provider.ID, `
+		type = ?, label = ?, feed_url = ?, poll_frequency_seconds = ?, schedule = ?, quiet_hours = ?, timezone = ?,
+		adaptive = ?, min_poll_frequency_seconds = ?, max_poll_frequency_seconds = ?, retention_days = ?,
+		learned_poll_frequency_seconds = 0, etag = '', last_modified = '', consecutive_failures = 0, last_error = '',
+		last_failure = ?, paused_until = ?`,
+		provider.Type, provider.Label, provider.FeedURL, provider.PollFrequencySeconds, provider.Schedule,
+		string(quietHours), provider.Timezone, provider.Adaptive, provider.MinPollFrequencySeconds,
+		provider.MaxPollFrequencySeconds, provider.RetentionDays, formatTime(zero.LastFailure),
+		formatTime(zero.PausedUntil),
+	)
+}
+
+// DeleteProvider deletes the provider related to `providerID`. `storage.ErrNotFound` is returned if there's no such
+// provider.
+func (pr *ProviderRepository) DeleteProvider(ctx context.Context, providerID string) error {
+	id, ok := parseProviderID(providerID)
+	if !ok {
+		return providerNotFound(providerID)
+	}
+
+	res, err := pr.db.ExecContext(ctx, `DELETE FROM providers WHERE id = ?`, id)
+	if err != nil {
+		return errors.Wrap(err, "delete provider")
+	}
+	return checkAffected(res, providerID)
+}
+
+// UpdateFetchState replaces the fetch state of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdateFetchState(ctx context.Context, providerID string, state storage.FetchState) error {
+	return pr.update(ctx, providerID, `etag = ?, last_modified = ?`, state.ETag, state.LastModified)
+}
+
+// UpdatePollStatus replaces the poll status of the provider related to the specified `providerID`
+func (pr *ProviderRepository) UpdatePollStatus(ctx context.Context, providerID string, status storage.PollStatus) error {
+	return pr.update(ctx, providerID, `consecutive_failures = ?, last_error = ?, last_failure = ?, paused_until = ?`,
+		status.ConsecutiveFailures, status.LastError, formatTime(status.LastFailure), formatTime(status.PausedUntil))
+}
+
+// UpdateLearnedPollFrequency records the poll frequency learned by adaptive polling of the provider related to the
+// specified `providerID`
+func (pr *ProviderRepository) UpdateLearnedPollFrequency(ctx context.Context, providerID string, seconds int) error {
+	return pr.update(ctx, providerID, `learned_poll_frequency_seconds = ?`, seconds)
+}
+
+// update sets the columns in `set` of the provider related to `providerID` to the values in `args`.
+// `storage.ErrNotFound` is returned if there's no such provider.
+func (pr *ProviderRepository) update(ctx context.Context, providerID, set string, args ...interface{}) error {
+	id, ok := parseProviderID(providerID)
+	if !ok {
+		return providerNotFound(providerID)
+	}
+
+	res, err := pr.db.ExecContext(ctx, `UPDATE providers SET `+set+` WHERE id = ?`, append(args, id)...)
+	if err != nil {
+		return errors.Wrap(err, "update provider")
+	}
+	return checkAffected(res, providerID)
+}
+
+func checkAffected(res sql.Result, providerID string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.Wrap(err, "rows affected")
+	}
+	if n == 0 {
+		return providerNotFound(providerID)
+	}
+	return nil
+}
+
+func scanProvider(s scanner) (storage.Provider, error) {
+	var p storage.Provider
+	var id int64
+	var quietHours string
+	err := s.Scan(&id, &p.Type, &p.Label, &p.FeedURL, &p.PollFrequencySeconds, &p.Schedule, &quietHours, &p.Timezone,
+		&p.Adaptive, &p.MinPollFrequencySeconds, &p.MaxPollFrequencySeconds, &p.LearnedPollFrequencySeconds,
+		&p.FetchState.ETag, &p.FetchState.LastModified, &p.Status.ConsecutiveFailures, &p.Status.LastError,
+		timeValue{&p.Status.LastFailure}, timeValue{&p.Status.PausedUntil}, &p.RetentionDays)
+	if err != nil {
+		return storage.Provider{}, err
+	}
+	err = json.Unmarshal([]byte(quietHours), &p.QuietHours)
+	if err != nil {
+		return storage.Provider{}, errors.Wrap(err, "unmarshal quiet hours")
+	}
+	p.ID = strconv.FormatInt(id, 10)
+	return p, nil
+}
+
+// parseProviderID parses a provider ID, which is false if it can't be the ID of a provider
+func parseProviderID(providerID string) (int64, bool) {
+	id, err := strconv.ParseInt(providerID, 10, 64)
+	return id, err == nil && id > 0
+}
+
+func providerNotFound(providerID string) error {
+	return storage.ErrNotFound{
+		Message: fmt.Sprintf("No provider found for ID `%s`", providerID),
+	}
+}
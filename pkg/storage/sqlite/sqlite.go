@@ -0,0 +1,98 @@
+// Package sqlite implements the storage repositories in a local SQLite file, for running on a single node. Article
+// search uses FTS5, which go-sqlite3 only includes when built with `-tags sqlite_fts5`.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+
+	_ "github.com/mattn/go-sqlite3" // Register the sqlite3 driver
+)
+
+// timeFormat is fixed width, so times stored as text sort in time order
+const timeFormat = "2006-01-02T15:04:05.000000000Z"
+
+// errNoFTS5 is returned by Open when SQLite was built without full-text search
+var errNoFTS5 = errors.New("SQLite was built without FTS5, build with `-tags sqlite_fts5`")
+
+// Open opens the database in the file at `path`, creating it if needed, and brings its schema up to date
+func Open(path string) (*sql.DB, error) {
+	params := url.Values{}
+	params.Set("_busy_timeout", "5000")
+	params.Set("_journal_mode", "WAL")
+	params.Set("_foreign_keys", "true")
+	db, err := sql.Open("sqlite3", "file:"+path+"?"+params.Encode())
+	if err != nil {
+		return nil, errors.Wrap(err, "sql.Open()")
+	}
+	// SQLite allows one writer at a time, so writes are serialised here rather than failing as busy
+	db.SetMaxOpenConns(1)
+
+	ctx := context.Background()
+	var fts5 bool
+	err = db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts5)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "check compile options")
+	}
+	if !fts5 {
+		db.Close()
+		return nil, errNoFTS5
+	}
+
+	err = Migrate(ctx, db)
+	if err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "migrate database")
+	}
+	return db, nil
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(timeFormat)
+}
+
+// timeValue scans a time stored as text
+type timeValue struct {
+	t *time.Time
+}
+
+func (v timeValue) Scan(src interface{}) error {
+	var s string
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	default:
+		return fmt.Errorf("can't scan %T into a time", src)
+	}
+	t, err := time.Parse(timeFormat, s)
+	if err != nil {
+		return err
+	}
+	*v.t = t
+	return nil
+}
+
+// placeholders returns `n` comma separated placeholders
+func placeholders(n int) string {
+	result := make([]byte, 0, n*3)
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			result = append(result, ", "...)
+		}
+		result = append(result, '?')
+	}
+	return string(result)
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/chackett/zignews/pkg/storage/storagetest"
+)
+
+// The conformance tests are skipped unless built with `-tags sqlite_fts5`, as the schema needs FTS5. Each test uses
+// its own database file.
+
+// testDB returns a new, migrated database
+func testDB(t *testing.T) *sql.DB {
+	db, err := Open(filepath.Join(t.TempDir(), "zignews.db"))
+	if err == errNoFTS5 {
+		t.Skip(err.Error())
+	}
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+func TestArticleRepository(t *testing.T) {
+	storagetest.TestArticleRepository(t, func(t *testing.T) storage.ArticleRepository {
+		return NewArticleRepository(testDB(t))
+	})
+}
+
+func TestProviderRepository(t *testing.T) {
+	storagetest.TestProviderRepository(t, func(t *testing.T) storage.ProviderRepository {
+		db := testDB(t)
+		// The tests need an empty repository, not the bootstrapped providers
+		_, err := db.Exec(`DELETE FROM providers`)
+		if err != nil {
+			t.Fatalf("delete bootstrapped providers - %v", err)
+		}
+		return NewProviderRepository(db)
+	})
+}
+
+func TestLeaseRepository(t *testing.T) {
+	storagetest.TestLeaseRepository(t, func(t *testing.T) storage.LeaseRepository {
+		return NewLeaseRepository(testDB(t))
+	})
+}
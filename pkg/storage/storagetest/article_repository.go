@@ -0,0 +1,586 @@
+// Package storagetest checks that repository implementations behave the same as each other, so any of them can be used
+// by the services. Each repository package runs the tests from its own tests.
+package storagetest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+	"github.com/pkg/errors"
+)
+
+// testProviderID is the provider the test articles are from
+const testProviderID = "5f8d0d55b54764421b7156c9"
+
+// epoch is the published time of the oldest test article. Times are whole milliseconds, as some stores don't keep more.
+var epoch = time.Date(2020, 10, 1, 12, 0, 0, 0, time.UTC)
+
+// TestArticleRepository runs the conformance tests for `storage.ArticleRepository`. `newRepo` must return an empty
+// repository each time it's called.
+func TestArticleRepository(t *testing.T, newRepo func(t *testing.T) storage.ArticleRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo storage.ArticleRepository)
+	}{
+		{"InsertResult", testInsertResult},
+		{"UpsertByID", testUpsertByID},
+		{"InsertWithoutID", testInsertWithoutID},
+		{"SharedGUID", testSharedGUID},
+		{"GetArticle", testGetArticle},
+		{"GetArticleNotFound", testGetArticleNotFound},
+		{"Order", testArticleOrder},
+		{"Filters", testArticleFilters},
+		{"DateRange", testArticleDateRange},
+		{"OffsetPages", testArticleOffsetPages},
+		{"CursorPages", testArticleCursorPages},
+		{"FullLastPage", testArticleFullLastPage},
+		{"InvalidCursor", testArticleInvalidCursor},
+		{"Fields", testArticleFields},
+		{"Search", testSearch},
+		{"ExpiredArticles", testExpiredArticles},
+		{"DeleteArticles", testDeleteArticles},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepo(t))
+		})
+	}
+}
+
+// newArticle returns a test article, published `n` hours after epoch
+func newArticle(guid string, n int) storage.Article {
+	return storage.Article{
+		ID:          storage.ArticleID(testProviderID, guid),
+		ProviderID:  testProviderID,
+		GUID:        guid,
+		Title:       "Article " + guid,
+		Link:        "https://example.com/" + guid,
+		Description: "Description of " + guid,
+		Published:   epoch.Add(time.Duration(n) * time.Hour),
+		Categories:  []string{"news"},
+		Provider:    "Example",
+	}
+}
+
+// newArticles returns `n` test articles, each published an hour after the last
+func newArticles(n int) []storage.Article {
+	var result []storage.Article
+	for i := 0; i < n; i++ {
+		result = append(result, newArticle(fmt.Sprintf("guid-%02d", i), i))
+	}
+	return result
+}
+
+func insert(t *testing.T, repo storage.ArticleRepository, articles ...storage.Article) storage.InsertResult {
+	t.Helper()
+	result, err := repo.InsertArticles(context.Background(), articles)
+	if err != nil {
+		t.Fatalf("InsertArticles() error = %v", err)
+	}
+	return result
+}
+
+func getArticles(t *testing.T, repo storage.ArticleRepository, query storage.ArticleQuery) storage.ArticlePage {
+	t.Helper()
+	page, err := repo.GetArticles(context.Background(), query)
+	if err != nil {
+		t.Fatalf("GetArticles(%+v) error = %v", query, err)
+	}
+	return page
+}
+
+func testInsertResult(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(3)
+	result := insert(t, repo, articles...)
+	assertIDs(t, "first insert Inserted", result.Inserted, ids(articles...))
+	assertIDs(t, "first insert Modified", result.Modified, nil)
+	assertIDs(t, "first insert Unchanged", result.Unchanged, nil)
+
+	articles[1].Title = "Changed"
+	articles = append(articles, newArticle("guid-new", 10))
+	result = insert(t, repo, articles...)
+	assertIDs(t, "second insert Inserted", result.Inserted, ids(articles[3]))
+	assertIDs(t, "second insert Modified", result.Modified, ids(articles[1]))
+	assertIDs(t, "second insert Unchanged", result.Unchanged, ids(articles[0], articles[2]))
+}
+
+func testUpsertByID(t *testing.T, repo storage.ArticleRepository) {
+	article := newArticle("guid", 0)
+	insert(t, repo, article)
+	first, err := repo.GetArticle(context.Background(), article.ID)
+	if err != nil {
+		t.Fatalf("GetArticle() error = %v", err)
+	}
+	if first.Ingested.IsZero() {
+		t.Errorf("Ingested isn't set when an article is inserted")
+	}
+
+	article.Title = "Updated"
+	insert(t, repo, article)
+
+	page := getArticles(t, repo, storage.ArticleQuery{Count: 10})
+	if len(page.Articles) != 1 {
+		t.Fatalf("got %d articles after upserting the same ID, want 1", len(page.Articles))
+	}
+	got := page.Articles[0]
+	if got.Title != "Updated" {
+		t.Errorf("Title = %q, want %q", got.Title, "Updated")
+	}
+	if !got.Ingested.Equal(first.Ingested) {
+		t.Errorf("Ingested changed from %s to %s when updated", first.Ingested, got.Ingested)
+	}
+}
+
+func testInsertWithoutID(t *testing.T, repo storage.ArticleRepository) {
+	article := newArticle("guid", 0)
+	want := article.ID
+	article.ID = ""
+	result := insert(t, repo, article)
+	assertIDs(t, "Inserted", result.Inserted, []string{want})
+
+	got, err := repo.GetArticle(context.Background(), want)
+	if err != nil {
+		t.Fatalf("GetArticle() error = %v", err)
+	}
+	if got.ID != want {
+		t.Errorf("ID = %q, want %q", got.ID, want)
+	}
+}
+
+func testSharedGUID(t *testing.T, repo storage.ArticleRepository) {
+	const otherProviderID = "5f8d0d55b54764421b7156ca"
+	article := newArticle("guid", 0)
+	other := newArticle("guid", 1)
+	other.ProviderID = otherProviderID
+	other.ID = storage.ArticleID(otherProviderID, other.GUID)
+	other.Title = "Other"
+
+	result := insert(t, repo, article, other)
+	assertIDs(t, "first insert Inserted", result.Inserted, ids(article, other))
+
+	// Articles from different providers with the same GUID are separate, so neither changes the other
+	result = insert(t, repo, article, other)
+	assertIDs(t, "second insert Modified", result.Modified, nil)
+	assertIDs(t, "second insert Unchanged", result.Unchanged, ids(article, other))
+
+	for _, want := range []storage.Article{article, other} {
+		got, err := repo.GetArticle(context.Background(), want.ID)
+		if err != nil {
+			t.Fatalf("GetArticle(%q) error = %v", want.ID, err)
+		}
+		if got.ProviderID != want.ProviderID || got.Title != want.Title {
+			t.Errorf("GetArticle(%q) = provider %q, title %q, want provider %q, title %q",
+				want.ID, got.ProviderID, got.Title, want.ProviderID, want.Title)
+		}
+	}
+}
+
+func testGetArticle(t *testing.T, repo storage.ArticleRepository) {
+	want := newArticle("guid", 0)
+	want.Content = "<p>Content</p>"
+	want.Author = "Author"
+	want.Updated = epoch.Add(time.Minute)
+	want.Thumbnail = "https://example.com/image.png"
+	want.Categories = []string{"news", "tech"}
+	insert(t, repo, want)
+
+	got, err := repo.GetArticle(context.Background(), want.ID)
+	if err != nil {
+		t.Fatalf("GetArticle() error = %v", err)
+	}
+	want.Ingested = got.Ingested
+	assertArticle(t, got, want)
+}
+
+func testGetArticleNotFound(t *testing.T, repo storage.ArticleRepository) {
+	insert(t, repo, newArticles(2)...)
+	_, err := repo.GetArticle(context.Background(), storage.ArticleID(testProviderID, "missing"))
+	assertNotFound(t, "GetArticle()", err)
+}
+
+func testArticleOrder(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(4)
+	// Articles published at the same time are ordered by ID
+	tied := newArticle("guid-tied", 2)
+	articles = append(articles, tied)
+	articles[0].Title, articles[1].Title, articles[2].Title, articles[3].Title, articles[4].Title = "d", "b", "e", "a", "c"
+	insert(t, repo, articles...)
+
+	byPublished := []storage.Article{articles[3], articles[2], tied, articles[1], articles[0]}
+	if articles[2].ID < tied.ID {
+		byPublished[1], byPublished[2] = tied, articles[2]
+	}
+	reversed := make([]storage.Article, len(byPublished))
+	for i, a := range byPublished {
+		reversed[len(byPublished)-1-i] = a
+	}
+
+	tests := []struct {
+		name  string
+		query storage.ArticleQuery
+		want  []storage.Article
+	}{
+		{"default newest first", storage.ArticleQuery{}, byPublished},
+		{"published ascending", storage.ArticleQuery{Sort: storage.SortPublished, Order: storage.OrderAscending}, reversed},
+		{"title A-Z", storage.ArticleQuery{Sort: storage.SortTitle}, []storage.Article{articles[3], articles[1], articles[4], articles[0], articles[2]}},
+		{"title Z-A", storage.ArticleQuery{Sort: storage.SortTitle, Order: storage.OrderDescending}, []storage.Article{articles[2], articles[0], articles[4], articles[1], articles[3]}},
+	}
+	for _, tc := range tests {
+		tc.query.Count = 10
+		page := getArticles(t, repo, tc.query)
+		assertOrder(t, tc.name, page.Articles, ids(tc.want...))
+	}
+
+	// Ingestion order is only known to the repository, but must be consistent with the ingested times
+	page := getArticles(t, repo, storage.ArticleQuery{Count: 10, Sort: storage.SortIngested})
+	for i := 1; i < len(page.Articles); i++ {
+		if page.Articles[i].Ingested.After(page.Articles[i-1].Ingested) {
+			t.Errorf("sort by ingested: article %d was ingested after article %d", i, i-1)
+		}
+	}
+}
+
+func testArticleFilters(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(4)
+	articles[0].Categories = []string{"politics"}
+	articles[1].Categories = []string{"technology", "science"}
+	articles[2].Provider = "Other"
+	articles[3].Categories = nil
+	insert(t, repo, articles...)
+
+	tests := []struct {
+		name  string
+		query storage.ArticleQuery
+		want  []storage.Article
+	}{
+		{"category", storage.ArticleQuery{Categories: []string{"science"}}, []storage.Article{articles[1]}},
+		{"any category", storage.ArticleQuery{Categories: []string{"politics", "technology"}}, []storage.Article{articles[1], articles[0]}},
+		{"provider", storage.ArticleQuery{Providers: []string{"Other"}}, []storage.Article{articles[2]}},
+		{"category and provider", storage.ArticleQuery{Categories: []string{"news"}, Providers: []string{"Example"}}, nil},
+		{"no filters", storage.ArticleQuery{}, []storage.Article{articles[3], articles[2], articles[1], articles[0]}},
+	}
+	for _, tc := range tests {
+		tc.query.Count = 10
+		page := getArticles(t, repo, tc.query)
+		assertOrder(t, tc.name, page.Articles, ids(tc.want...))
+	}
+}
+
+func testArticleDateRange(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(5)
+	insert(t, repo, articles...)
+
+	// Since is inclusive and until exclusive
+	query := storage.ArticleQuery{
+		Count: 10,
+		Since: articles[1].Published,
+		Until: articles[3].Published,
+	}
+	page := getArticles(t, repo, query)
+	assertOrder(t, "since and until", page.Articles, ids(articles[2], articles[1]))
+
+	_, err := repo.GetArticles(context.Background(), storage.ArticleQuery{Count: 10, Since: query.Until, Until: query.Since})
+	if _, ok := errors.Cause(err).(storage.ErrInvalidQuery); !ok {
+		t.Errorf("until before since: error = %v, want storage.ErrInvalidQuery", err)
+	}
+}
+
+func testArticleOffsetPages(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(5)
+	insert(t, repo, articles...)
+
+	// Offset counts pages, not articles
+	page := getArticles(t, repo, storage.ArticleQuery{Offset: 1, Count: 2})
+	assertOrder(t, "second page", page.Articles, ids(articles[2], articles[1]))
+	page = getArticles(t, repo, storage.ArticleQuery{Offset: 2, Count: 2})
+	assertOrder(t, "last page", page.Articles, ids(articles[0]))
+	if page.NextCursor != "" {
+		t.Errorf("last page has a next cursor")
+	}
+}
+
+func testArticleCursorPages(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(7)
+	insert(t, repo, articles...)
+
+	query := storage.ArticleQuery{Count: 3}
+	var got []storage.Article
+	for i := 0; ; i++ {
+		page := getArticles(t, repo, query)
+		got = append(got, page.Articles...)
+		if i == 0 {
+			// Newer articles arriving mustn't shift the following pages
+			insert(t, repo, newArticle("guid-newer", 100))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		if i > len(articles) {
+			t.Fatalf("cursor pages don't end")
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	var want []storage.Article
+	for i := len(articles) - 1; i >= 0; i-- {
+		want = append(want, articles[i])
+	}
+	assertOrder(t, "cursor pages", got, ids(want...))
+
+	// Cursors work for every sort
+	query = storage.ArticleQuery{Count: 2, Sort: storage.SortTitle, Order: storage.OrderDescending}
+	first := getArticles(t, repo, query)
+	query.Cursor = first.NextCursor
+	second := getArticles(t, repo, query)
+	all := getArticles(t, repo, storage.ArticleQuery{Count: 4, Sort: storage.SortTitle, Order: storage.OrderDescending})
+	assertOrder(t, "cursor pages by title", append(first.Articles, second.Articles...), ids(all.Articles...))
+}
+
+func testArticleFullLastPage(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(4)
+	insert(t, repo, articles...)
+
+	query := storage.ArticleQuery{Count: 2}
+	first := getArticles(t, repo, query)
+	assertOrder(t, "first page", first.Articles, ids(articles[3], articles[2]))
+	if first.NextCursor == "" {
+		t.Fatalf("first page has no next cursor")
+	}
+	query.Cursor = first.NextCursor
+	second := getArticles(t, repo, query)
+	assertOrder(t, "second page", second.Articles, ids(articles[1], articles[0]))
+	if second.NextCursor != "" {
+		t.Errorf("full last page has a next cursor")
+	}
+
+	// The same goes for pages counted by offset
+	second = getArticles(t, repo, storage.ArticleQuery{Count: 2, Offset: 1})
+	assertOrder(t, "second page by offset", second.Articles, ids(articles[1], articles[0]))
+	if second.NextCursor != "" {
+		t.Errorf("full last page by offset has a next cursor")
+	}
+}
+
+func testArticleInvalidCursor(t *testing.T, repo storage.ArticleRepository) {
+	insert(t, repo, newArticles(3)...)
+
+	_, err := repo.GetArticles(context.Background(), storage.ArticleQuery{Count: 2, Cursor: "not a cursor"})
+	if errors.Cause(err) != storage.ErrInvalidCursor {
+		t.Errorf("GetArticles() with invalid cursor error = %v, want %v", err, storage.ErrInvalidCursor)
+	}
+
+	// A cursor is only valid for the order it was created with
+	page := getArticles(t, repo, storage.ArticleQuery{Count: 2})
+	_, err = repo.GetArticles(context.Background(), storage.ArticleQuery{Count: 2, Cursor: page.NextCursor, Sort: storage.SortTitle})
+	if errors.Cause(err) != storage.ErrInvalidCursor {
+		t.Errorf("GetArticles() with cursor for another order error = %v, want %v", err, storage.ErrInvalidCursor)
+	}
+}
+
+func testArticleFields(t *testing.T, repo storage.ArticleRepository) {
+	article := newArticle("guid", 0)
+	insert(t, repo, article)
+
+	page := getArticles(t, repo, storage.ArticleQuery{Count: 10, Fields: []string{"title", "link"}})
+	if len(page.Articles) != 1 {
+		t.Fatalf("got %d articles, want 1", len(page.Articles))
+	}
+	got := page.Articles[0]
+	want := storage.Article{
+		ID:        article.ID,
+		Title:     article.Title,
+		Link:      article.Link,
+		Published: article.Published, // Needed for the cursor
+	}
+	assertArticle(t, got, want)
+
+	_, err := repo.GetArticles(context.Background(), storage.ArticleQuery{Count: 10, Fields: []string{"nope"}})
+	if _, ok := errors.Cause(err).(storage.ErrInvalidQuery); !ok {
+		t.Errorf("unknown field: error = %v, want storage.ErrInvalidQuery", err)
+	}
+}
+
+func testSearch(t *testing.T, repo storage.ArticleRepository) {
+	articles := newArticles(4)
+	articles[0].Title = "Volcano erupts"
+	articles[1].Description = "Scientists watch the volcano"
+	articles[2].Title = "Volcano quiet"
+	articles[2].Provider = "Other"
+	articles[3].Title = "Unrelated"
+	insert(t, repo, articles...)
+
+	search := func(query storage.SearchQuery) []storage.Article {
+		t.Helper()
+		query.Count = 10
+		result, err := repo.Search(context.Background(), query)
+		if err != nil {
+			t.Fatalf("Search(%+v) error = %v", query, err)
+		}
+		return result
+	}
+
+	got := search(storage.SearchQuery{Text: "volcano", Rank: storage.RankRecency})
+	assertOrder(t, "recency", got, ids(articles[2], articles[1], articles[0]))
+
+	// Matches in titles rank above matches in descriptions
+	got = search(storage.SearchQuery{Text: "volcano", Rank: storage.RankRelevance})
+	if len(got) != 3 || got[2].ID != articles[1].ID {
+		t.Errorf("relevance: got %v, want the description match last", ids(got...))
+	}
+
+	got = search(storage.SearchQuery{Text: "volcano", Rank: storage.RankRecency, Providers: []string{"Other"}})
+	assertOrder(t, "provider filter", got, ids(articles[2]))
+
+	got = search(storage.SearchQuery{Text: "tsunami", Rank: storage.RankRecency})
+	assertOrder(t, "no matches", got, nil)
+}
+
+func testExpiredArticles(t *testing.T, repo storage.ArticleRepository) {
+	const otherProviderID = "5f8d0d55b54764421b7156ca"
+	articles := newArticles(2)
+	other := newArticle("other", 2)
+	other.ProviderID = otherProviderID
+	other.ID = storage.ArticleID(otherProviderID, other.GUID)
+	// Each is ingested a little after the last, so they're in a known order
+	for i, art := range []storage.Article{articles[1], other, articles[0]} {
+		if i > 0 {
+			time.Sleep(20 * time.Millisecond)
+		}
+		insert(t, repo, art)
+	}
+
+	expired := func(query storage.ExpiryQuery) []storage.Article {
+		t.Helper()
+		result, err := repo.ExpiredArticles(context.Background(), query)
+		if err != nil {
+			t.Fatalf("ExpiredArticles(%+v) error = %v", query, err)
+		}
+		return result
+	}
+	later := time.Now().Add(time.Hour)
+
+	got := expired(storage.ExpiryQuery{Before: later})
+	assertOrder(t, "oldest first", got, ids(articles[1], other, articles[0]))
+	if len(got) > 0 {
+		// Expired articles are returned whole, so they can be archived
+		want := articles[1]
+		want.Ingested = got[0].Ingested
+		assertArticle(t, got[0], want)
+	}
+
+	got = expired(storage.ExpiryQuery{Before: later, Count: 2})
+	assertOrder(t, "count", got, ids(articles[1], other))
+
+	got = expired(storage.ExpiryQuery{Before: later, ProviderIDs: []string{testProviderID}})
+	assertOrder(t, "providers", got, ids(articles[1], articles[0]))
+
+	got = expired(storage.ExpiryQuery{Before: later, ExcludeProviderIDs: []string{testProviderID}})
+	assertOrder(t, "excluded providers", got, ids(other))
+
+	got = expired(storage.ExpiryQuery{Before: time.Now().Add(-time.Hour)})
+	assertOrder(t, "none ingested before", got, nil)
+}
+
+func testDeleteArticles(t *testing.T, repo storage.ArticleRepository) {
+	ctx := context.Background()
+	articles := newArticles(3)
+	insert(t, repo, articles...)
+
+	deleted, err := repo.DeleteArticles(ctx, []string{articles[0].ID, articles[1].ID, "missing"})
+	if err != nil {
+		t.Fatalf("DeleteArticles() error = %v", err)
+	}
+	if deleted != 2 {
+		t.Errorf("DeleteArticles() = %d, want 2", deleted)
+	}
+	_, err = repo.GetArticle(ctx, articles[0].ID)
+	assertNotFound(t, "GetArticle() after delete", err)
+
+	// Deleted articles are gone from the listing, category filters and search
+	page := getArticles(t, repo, storage.ArticleQuery{Count: 10, Categories: []string{"news"}})
+	assertOrder(t, "articles after delete", page.Articles, ids(articles[2]))
+	found, err := repo.Search(ctx, storage.SearchQuery{Text: "article", Rank: storage.RankRecency, Count: 10})
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	assertOrder(t, "search after delete", found, ids(articles[2]))
+
+	deleted, err = repo.DeleteArticles(ctx, nil)
+	if err != nil || deleted != 0 {
+		t.Errorf("DeleteArticles(nil) = %d, %v, want 0, nil", deleted, err)
+	}
+}
+
+func ids(articles ...storage.Article) []string {
+	var result []string
+	for _, a := range articles {
+		result = append(result, a.ID)
+	}
+	return result
+}
+
+// assertIDs checks `got` holds the same IDs as `want`, in any order
+func assertIDs(t *testing.T, name string, got, want []string) {
+	t.Helper()
+	count := map[string]int{}
+	for _, id := range got {
+		count[id]++
+	}
+	for _, id := range want {
+		count[id]--
+	}
+	for _, c := range count {
+		if c != 0 {
+			t.Errorf("%s = %v, want %v", name, got, want)
+			return
+		}
+	}
+}
+
+// assertOrder checks `got` are the articles with IDs `want`, in order
+func assertOrder(t *testing.T, name string, got []storage.Article, want []string) {
+	t.Helper()
+	gotIDs := ids(got...)
+	if len(gotIDs) != len(want) {
+		t.Errorf("%s: got articles %v, want %v", name, gotIDs, want)
+		return
+	}
+	for i := range want {
+		if gotIDs[i] != want[i] {
+			t.Errorf("%s: got articles %v, want %v", name, gotIDs, want)
+			return
+		}
+	}
+}
+
+func assertArticle(t *testing.T, got, want storage.Article) {
+	t.Helper()
+	same := got.ID == want.ID &&
+		got.ProviderID == want.ProviderID &&
+		got.Title == want.Title &&
+		got.Link == want.Link &&
+		got.Description == want.Description &&
+		got.Content == want.Content &&
+		got.Author == want.Author &&
+		got.Published.Equal(want.Published) &&
+		got.Updated.Equal(want.Updated) &&
+		got.Ingested.Equal(want.Ingested) &&
+		got.GUID == want.GUID &&
+		got.Thumbnail == want.Thumbnail &&
+		fmt.Sprint(got.Categories) == fmt.Sprint(want.Categories) &&
+		got.Provider == want.Provider
+	if !same {
+		t.Errorf("got article %+v, want %+v", got, want)
+	}
+}
+
+func assertNotFound(t *testing.T, name string, err error) {
+	t.Helper()
+	if _, ok := errors.Cause(err).(storage.ErrNotFound); !ok {
+		t.Errorf("%s error = %v, want storage.ErrNotFound", name, err)
+	}
+}
@@ -0,0 +1,100 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+// TestLeaseRepository runs the conformance tests for `storage.LeaseRepository`. `newRepo` must return an empty
+// repository each time it's called.
+func TestLeaseRepository(t *testing.T, newRepo func(t *testing.T) storage.LeaseRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo storage.LeaseRepository)
+	}{
+		{"Exclusive", testLeaseExclusive},
+		{"Expiry", testLeaseExpiry},
+		{"Release", testLeaseRelease},
+		{"GetLeases", testGetLeases},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepo(t))
+		})
+	}
+}
+
+func acquire(t *testing.T, repo storage.LeaseRepository, name, owner string, ttl time.Duration) bool {
+	t.Helper()
+	held, err := repo.AcquireLease(context.Background(), name, owner, ttl)
+	if err != nil {
+		t.Fatalf("AcquireLease(%s, %s) error = %v", name, owner, err)
+	}
+	return held
+}
+
+func testLeaseExclusive(t *testing.T, repo storage.LeaseRepository) {
+	if !acquire(t, repo, "lease", "a", time.Minute) {
+		t.Fatalf("a couldn't acquire a new lease")
+	}
+	if acquire(t, repo, "lease", "b", time.Minute) {
+		t.Errorf("b acquired a lease held by a")
+	}
+	if !acquire(t, repo, "lease", "a", time.Minute) {
+		t.Errorf("a couldn't renew its own lease")
+	}
+	if !acquire(t, repo, "other", "b", time.Minute) {
+		t.Errorf("b couldn't acquire a different lease")
+	}
+}
+
+func testLeaseExpiry(t *testing.T, repo storage.LeaseRepository) {
+	acquire(t, repo, "lease", "a", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+	if !acquire(t, repo, "lease", "b", time.Minute) {
+		t.Errorf("b couldn't acquire an expired lease")
+	}
+	if acquire(t, repo, "lease", "a", time.Minute) {
+		t.Errorf("a acquired its expired lease after b took it")
+	}
+}
+
+func testLeaseRelease(t *testing.T, repo storage.LeaseRepository) {
+	ctx := context.Background()
+	acquire(t, repo, "lease", "a", time.Minute)
+
+	// Only the owner can release a lease
+	mustNot(t, "ReleaseLease()", repo.ReleaseLease(ctx, "lease", "b"))
+	if acquire(t, repo, "lease", "b", time.Minute) {
+		t.Errorf("b acquired a lease it released without owning")
+	}
+
+	mustNot(t, "ReleaseLease()", repo.ReleaseLease(ctx, "lease", "a"))
+	if !acquire(t, repo, "lease", "b", time.Minute) {
+		t.Errorf("b couldn't acquire a released lease")
+	}
+}
+
+func testGetLeases(t *testing.T, repo storage.LeaseRepository) {
+	acquire(t, repo, "group/a", "a", time.Minute)
+	acquire(t, repo, "group/b", "b", time.Minute)
+	acquire(t, repo, "group/expired", "c", time.Millisecond)
+	acquire(t, repo, "other/a", "a", time.Minute)
+	time.Sleep(10 * time.Millisecond)
+
+	leases, err := repo.GetLeases(context.Background(), "group/")
+	if err != nil {
+		t.Fatalf("GetLeases() error = %v", err)
+	}
+	owners := map[string]string{}
+	for _, l := range leases {
+		owners[l.Name] = l.Owner
+	}
+	if len(owners) != 2 || owners["group/a"] != "a" || owners["group/b"] != "b" {
+		t.Errorf("GetLeases() = %+v, want the unexpired leases in the group", leases)
+	}
+}
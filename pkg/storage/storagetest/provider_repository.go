@@ -0,0 +1,221 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/chackett/zignews/pkg/schedule"
+	"github.com/chackett/zignews/pkg/storage"
+)
+
+// missingProviderID is a well formed provider ID that no provider has
+const missingProviderID = "000000000000000000000000"
+
+// TestProviderRepository runs the conformance tests for `storage.ProviderRepository`. `newRepo` must return an empty
+// repository each time it's called.
+func TestProviderRepository(t *testing.T, newRepo func(t *testing.T) storage.ProviderRepository) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, repo storage.ProviderRepository)
+	}{
+		{"GetProvider", testGetProvider},
+		{"GetProviderNotFound", testGetProviderNotFound},
+		{"GetProviders", testGetProviders},
+		{"UpdateProvider", testUpdateProvider},
+		{"DeleteProvider", testDeleteProvider},
+		{"UpdateState", testUpdateProviderState},
+		{"NotFound", testProviderNotFound},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, newRepo(t))
+		})
+	}
+}
+
+func newProvider(label string) storage.Provider {
+	return storage.Provider{
+		Type:                 "rss",
+		Label:                label,
+		FeedURL:              "https://example.com/" + label + ".xml",
+		PollFrequencySeconds: 300,
+	}
+}
+
+func insertProviders(t *testing.T, repo storage.ProviderRepository, providers ...storage.Provider) []string {
+	t.Helper()
+	result, err := repo.InsertProviders(context.Background(), providers)
+	if err != nil {
+		t.Fatalf("InsertProviders() error = %v", err)
+	}
+	if len(result) != len(providers) {
+		t.Fatalf("InsertProviders() returned %d IDs, want %d", len(result), len(providers))
+	}
+	return result
+}
+
+func getProvider(t *testing.T, repo storage.ProviderRepository, providerID string) storage.Provider {
+	t.Helper()
+	result, err := repo.GetProvider(context.Background(), providerID)
+	if err != nil {
+		t.Fatalf("GetProvider() error = %v", err)
+	}
+	return result
+}
+
+func testGetProvider(t *testing.T, repo storage.ProviderRepository) {
+	want := newProvider("full")
+	want.Schedule = "*/15 * * * *"
+	want.QuietHours = []schedule.Window{{Start: "23:00", End: "06:00", PollFrequencySeconds: 3600}}
+	want.Timezone = "Europe/London"
+	want.Adaptive = true
+	want.MinPollFrequencySeconds = 60
+	want.MaxPollFrequencySeconds = 3600
+	want.RetentionDays = 30
+	ids := insertProviders(t, repo, newProvider("other"), want)
+
+	got := getProvider(t, repo, ids[1])
+	want.ID = ids[1]
+	assertProvider(t, got, want)
+}
+
+func testGetProviderNotFound(t *testing.T, repo storage.ProviderRepository) {
+	insertProviders(t, repo, newProvider("a"))
+
+	_, err := repo.GetProvider(context.Background(), missingProviderID)
+	assertNotFound(t, "GetProvider()", err)
+	_, err = repo.GetProvider(context.Background(), "not an id")
+	assertNotFound(t, "GetProvider() with malformed ID", err)
+}
+
+func testGetProviders(t *testing.T, repo storage.ProviderRepository) {
+	ids := insertProviders(t, repo, newProvider("a"), newProvider("b"), newProvider("c"))
+
+	all, err := repo.GetProviders(context.Background(), 0, 10)
+	if err != nil {
+		t.Fatalf("GetProviders() error = %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("GetProviders() returned %d providers, want 3", len(all))
+	}
+
+	// Offset counts pages, not providers
+	seen := map[string]bool{}
+	for offset := 0; offset < 2; offset++ {
+		page, err := repo.GetProviders(context.Background(), offset, 2)
+		if err != nil {
+			t.Fatalf("GetProviders() error = %v", err)
+		}
+		for _, p := range page {
+			if seen[p.ID] {
+				t.Errorf("provider `%s` is on more than one page", p.ID)
+			}
+			seen[p.ID] = true
+		}
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			t.Errorf("provider `%s` isn't on any page", id)
+		}
+	}
+}
+
+func testUpdateProvider(t *testing.T, repo storage.ProviderRepository) {
+	ctx := context.Background()
+	ids := insertProviders(t, repo, newProvider("before"))
+	id := ids[0]
+	mustNot(t, "UpdateFetchState()", repo.UpdateFetchState(ctx, id, storage.FetchState{ETag: `"abc"`}))
+	mustNot(t, "UpdatePollStatus()", repo.UpdatePollStatus(ctx, id, storage.PollStatus{ConsecutiveFailures: 2, LastError: "failed"}))
+	mustNot(t, "UpdateLearnedPollFrequency()", repo.UpdateLearnedPollFrequency(ctx, id, 120))
+
+	want := newProvider("after")
+	want.ID = id
+	want.Type = "atom"
+	want.PollFrequencySeconds = 600
+	want.RetentionDays = 7
+	mustNot(t, "UpdateProvider()", repo.UpdateProvider(ctx, want))
+
+	// The fetch state, poll status and learned poll frequency are reset
+	assertProvider(t, getProvider(t, repo, id), want)
+}
+
+func testDeleteProvider(t *testing.T, repo storage.ProviderRepository) {
+	ids := insertProviders(t, repo, newProvider("a"), newProvider("b"))
+
+	mustNot(t, "DeleteProvider()", repo.DeleteProvider(context.Background(), ids[0]))
+	_, err := repo.GetProvider(context.Background(), ids[0])
+	assertNotFound(t, "GetProvider() after delete", err)
+	getProvider(t, repo, ids[1])
+}
+
+func testUpdateProviderState(t *testing.T, repo storage.ProviderRepository) {
+	ctx := context.Background()
+	ids := insertProviders(t, repo, newProvider("a"))
+	id := ids[0]
+
+	want := newProvider("a")
+	want.ID = id
+	want.FetchState = storage.FetchState{ETag: `"abc"`, LastModified: "Thu, 01 Oct 2020 12:00:00 GMT"}
+	want.Status = storage.PollStatus{
+		ConsecutiveFailures: 5,
+		LastError:           "get latest: timeout",
+		LastFailure:         epoch,
+		PausedUntil:         epoch.Add(6 * time.Hour),
+	}
+	want.LearnedPollFrequencySeconds = 90
+	mustNot(t, "UpdateFetchState()", repo.UpdateFetchState(ctx, id, want.FetchState))
+	mustNot(t, "UpdatePollStatus()", repo.UpdatePollStatus(ctx, id, want.Status))
+	mustNot(t, "UpdateLearnedPollFrequency()", repo.UpdateLearnedPollFrequency(ctx, id, want.LearnedPollFrequencySeconds))
+
+	assertProvider(t, getProvider(t, repo, id), want)
+}
+
+func testProviderNotFound(t *testing.T, repo storage.ProviderRepository) {
+	ctx := context.Background()
+	insertProviders(t, repo, newProvider("a"))
+
+	p := newProvider("missing")
+	p.ID = missingProviderID
+	assertNotFound(t, "UpdateProvider()", repo.UpdateProvider(ctx, p))
+	assertNotFound(t, "DeleteProvider()", repo.DeleteProvider(ctx, missingProviderID))
+	assertNotFound(t, "UpdateFetchState()", repo.UpdateFetchState(ctx, missingProviderID, storage.FetchState{}))
+	assertNotFound(t, "UpdatePollStatus()", repo.UpdatePollStatus(ctx, missingProviderID, storage.PollStatus{}))
+	assertNotFound(t, "UpdateLearnedPollFrequency()", repo.UpdateLearnedPollFrequency(ctx, missingProviderID, 60))
+}
+
+func mustNot(t *testing.T, name string, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s error = %v", name, err)
+	}
+}
+
+func assertProvider(t *testing.T, got, want storage.Provider) {
+	t.Helper()
+	same := got.ID == want.ID &&
+		got.Type == want.Type &&
+		got.Label == want.Label &&
+		got.FeedURL == want.FeedURL &&
+		got.PollFrequencySeconds == want.PollFrequencySeconds &&
+		got.Schedule == want.Schedule &&
+		len(got.QuietHours) == len(want.QuietHours) &&
+		got.Timezone == want.Timezone &&
+		got.Adaptive == want.Adaptive &&
+		got.MinPollFrequencySeconds == want.MinPollFrequencySeconds &&
+		got.MaxPollFrequencySeconds == want.MaxPollFrequencySeconds &&
+		got.LearnedPollFrequencySeconds == want.LearnedPollFrequencySeconds &&
+		got.RetentionDays == want.RetentionDays &&
+		got.FetchState == want.FetchState &&
+		got.Status.ConsecutiveFailures == want.Status.ConsecutiveFailures &&
+		got.Status.LastError == want.Status.LastError &&
+		got.Status.LastFailure.Equal(want.Status.LastFailure) &&
+		got.Status.PausedUntil.Equal(want.Status.PausedUntil)
+	for i := range want.QuietHours {
+		same = same && got.QuietHours[i] == want.QuietHours[i]
+	}
+	if !same {
+		t.Errorf("got provider %+v, want %+v", got, want)
+	}
+}